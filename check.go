@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/go-kit/kit/log/level"
 	"github.com/goware/urlx"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"net"
 	"net/url"
 	"reflect"
@@ -11,6 +13,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type (
@@ -19,40 +22,118 @@ type (
 		KubernetesRoute      *KubernetesRoute
 		KubernetesComponents *KubernetesComponents
 		Client               Client
-		RequiredChecks       []string
-		PassedChecks         []string
-		FailedChecks         []string
+		ClusterDomain        string
+		Resolver             *Resolver
+		ResolveOverrides     []*ResolveOverride
+		// PodThreshold is the percentage of pods on the route that must pass the pod checks.
+		PodThreshold float64
+		// Probe overrides the protocol picked for the listening checks, and carries raw send/expect payloads.
+		Probe *PortProbe
+		// Source is the --from pod CheckKubernetesRoutePodToPod connects from, and DebugImage the image of the
+		// ephemeral container used when the source pod has no shell or network tools, only attached when
+		// DebugContainer allows it.
+		Source         *Target
+		DebugImage     string
+		DebugContainer bool
+		// Origin is the address traffic from this host reaches the cluster from, discovered from OriginIpUrl
+		// when it is not given.
+		Origin         net.IP
+		OriginIpUrl    string
+		RequiredChecks []string
+		PassedChecks   []string
+		FailedChecks   []string
+		SkippedChecks  []string
 	}
 
 	Check struct {
 		Name     string
 		Priority int
+		Kinds    []TargetKind
 	}
 
 	KubernetesRoute struct {
-		Ingress *IngressPath
-		Service *ServicePort
-		Pods    []*PodPort
+		Ingress    *IngressPath
+		Service    *ServicePort
+		Pods       []*PodPort
+		PodResults []*PodResult
+	}
+
+	// PodResult collects the outcome of the pod checks for one pod on the route.
+	PodResult struct {
+		PodPort  *PodPort
+		Problems []string
+		// Listening is empty until CheckListeningPod has run.
+		Listening string
 	}
 
 	Target struct {
+		Kind      TargetKind
+		Scheme    string
+		Name      string
+		Namespace string
 		Host      string
 		Path      string
-		Port      int32
-		IpAddress net.IP
+		// ExplicitScheme is set when the target url included a scheme, rather than defaulting to http.
+		ExplicitScheme bool
+		Port           int32
+		PortName       string
+		Hostname       string
+		// IpAddress is the address the route is traced through, the first of the resolved records by default.
+		IpAddress  net.IP
+		Cidr       *net.IPNet
+		Records    []*DnsRecord
+		CnameChain []string
 	}
+
+	TargetKind string
+)
+
+const (
+	HostTarget    TargetKind = "host"
+	PodTarget     TargetKind = "pod"
+	ServiceTarget TargetKind = "svc"
+	// InternalHostTarget is a cluster DNS name, such as web.default.svc.cluster.local.
+	InternalHostTarget TargetKind = "internal"
+	// NamespaceTarget and CidrTarget are only used as --from sources.
+	NamespaceTarget TargetKind = "namespace"
+	CidrTarget      TargetKind = "cidr"
+
+	DefaultClusterDomain = "cluster.local"
+	DefaultPodThreshold  = 100
 )
 
 var (
 	checkList = []Check{
-		{"CheckKubernetesRouteFromHost", 0},
-		{"CheckStatusPod", 1},
-		{"CheckListeningPod", 2},
+		{"CheckKubernetesRouteFromHost", 0, []TargetKind{HostTarget}},
+		{"CheckKubernetesRouteFromPod", 0, []TargetKind{PodTarget}},
+		{"CheckKubernetesRouteFromService", 0, []TargetKind{ServiceTarget}},
+		{"CheckKubernetesRouteFromInternalHost", 0, []TargetKind{InternalHostTarget}},
+		{"CheckDnsResolvers", 1, []TargetKind{HostTarget}},
+		{"CheckEndpointsService", 1, nil},
+		{"CheckStatusPod", 1, nil},
+		{"CheckListeningPod", 2, nil},
+		{"CheckStatusNginxIngress", 2, nil},
+		{"CheckStatusTraefikIngress", 2, nil},
+		{"CheckStatusKubeDns", 2, []TargetKind{HostTarget, ServiceTarget, InternalHostTarget}},
+		{"CheckListeningHost", 3, []TargetKind{HostTarget}},
+		{"CheckNetworkPoliciesPod", 1, nil},
+		{"CheckSourceRangesService", 1, nil},
+		{"CheckSourceRangesIngress", 1, nil},
+		{"CheckKubernetesRoutePodToPod", 3, nil},
 	}
 )
 
 func (ch *Checker) ParseTarget(path string) (err error) {
 	ch.Target = &Target{}
+	switch {
+	case strings.HasPrefix(path, "pod/"):
+		return ch.parseResourceTarget(PodTarget, strings.TrimPrefix(path, "pod/"))
+	case strings.HasPrefix(path, "svc/"):
+		return ch.parseResourceTarget(ServiceTarget, strings.TrimPrefix(path, "svc/"))
+	case strings.HasPrefix(path, "service/"):
+		return ch.parseResourceTarget(ServiceTarget, strings.TrimPrefix(path, "service/"))
+	}
+	ch.Target.Kind = HostTarget
 	var parsedUrl *url.URL
 	parsedUrl, err = urlx.Parse(path)
 	if err != nil {
@@ -75,6 +156,8 @@ func (ch *Checker) ParseTarget(path string) (err error) {
 		return
 	}
 	ch.Target.Host = host
+	ch.Target.Scheme = normalizedUrl.Scheme
+	ch.Target.ExplicitScheme = strings.Contains(path, "://")
 	if normalizedUrl.Path == "" {
 		ch.Target.Path = "/"
 	} else {
@@ -95,15 +178,114 @@ func (ch *Checker) ParseTarget(path string) (err error) {
 			ch.Target.Port = 80
 		}
 	}
-	var ip *net.IPAddr
-	ip, err = urlx.Resolve(normalizedUrl)
+	if ch.parseInternalHost(host) {
+		return
+	}
+	for _, override := range ch.ResolveOverrides {
+		if override.Matches(ch.Target.Host, ch.Target.Port) {
+			ch.Target.Records = override.Records()
+			ch.Target.IpAddress = ch.Target.Records[0].IpAddress
+			return
+		}
+	}
+	resolver := ch.Resolver
+	if resolver == nil {
+		resolver = &Resolver{}
+	}
+	ch.Target.Records, ch.Target.CnameChain, err = resolver.Resolve(host)
 	if err != nil {
 		return
 	}
-	ch.Target.IpAddress = ip.IP
+	if len(ch.Target.Records) == 0 {
+		err = fmt.Errorf("could not resolve any addresses for %s", host)
+		return
+	}
+	ch.Target.IpAddress = ch.Target.Records[0].IpAddress
 	return
 }
 
+// parseResourceTarget parses targets in the form name[.namespace]:port, such as pod/grafana-xxx.metrics:3000.
+// The port may be a number or a port name, such as svc/grafana.metrics:http.
+func (ch *Checker) parseResourceTarget(kind TargetKind, ref string) (err error) {
+	ch.Target.Kind = kind
+	var name string
+	var port string
+	name, port, err = net.SplitHostPort(ref)
+	if err != nil {
+		return
+	}
+	ch.Target.Name, ch.Target.Namespace = splitNameNamespace(name)
+	parsedInt, parseErr := strconv.ParseInt(port, 10, 32)
+	if parseErr != nil {
+		ch.Target.PortName = port
+	} else {
+		ch.Target.Port = int32(parsedInt)
+	}
+	return
+}
+
+// splitNameNamespace splits name.namespace on the last dot, as pod names may contain dots but namespaces can't. A
+// pod name containing dots must therefore be given with its namespace.
+func splitNameNamespace(ref string) (name string, namespace string) {
+	i := strings.LastIndex(ref, ".")
+	if i < 0 {
+		return ref, ""
+	}
+	return ref[:i], ref[i+1:]
+}
+
+// parseInternalHost recognises cluster DNS names so they can be mapped onto services and pods without
+// external resolution. The supported forms, with or without the cluster domain, are:
+//
+//	service.namespace.svc
+//	hostname.service.namespace.svc (headless service and StatefulSet pods)
+//	1-2-3-4.namespace.pod
+func (ch *Checker) parseInternalHost(host string) bool {
+	clusterDomain := ch.ClusterDomain
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+	host = strings.TrimSuffix(strings.TrimSuffix(host, "."), "."+strings.Trim(clusterDomain, "."))
+	labels := strings.Split(host, ".")
+	switch {
+	case len(labels) == 3 && labels[2] == "svc":
+		ch.Target.Name = labels[0]
+		ch.Target.Namespace = labels[1]
+	case len(labels) == 4 && labels[3] == "svc":
+		ch.Target.Hostname = labels[0]
+		ch.Target.Name = labels[1]
+		ch.Target.Namespace = labels[2]
+	case len(labels) == 3 && labels[2] == "pod":
+		ip := net.ParseIP(strings.Replace(labels[0], "-", ".", -1))
+		if ip == nil {
+			ip = net.ParseIP(strings.Replace(labels[0], "-", ":", -1))
+		}
+		if ip == nil {
+			return false
+		}
+		ch.Target.IpAddress = ip
+		ch.Target.Namespace = labels[1]
+	default:
+		return false
+	}
+	ch.Target.Kind = InternalHostTarget
+	return true
+}
+
+// ForAddress returns a copy of the target traced through a single resolved address.
+func (t *Target) ForAddress(ip net.IP) *Target {
+	target := *t
+	target.IpAddress = ip
+	return &target
+}
+
+func (t *Target) MatchesPort(port int32, portName string) bool {
+	if t.PortName != "" {
+		return t.PortName == portName
+	}
+	return t.Port == port
+}
+
 func (ch *Checker) RunChecks() {
 	ch.InitChecks()
 	for _, check := range ch.RequiredChecks {
@@ -115,10 +297,24 @@ func (ch *Checker) RunChecks() {
 func (ch *Checker) InitChecks() {
 	sort.Slice(checkList, func(i, j int) bool { return checkList[i].Priority < checkList[j].Priority })
 	for _, check := range checkList {
-		ch.RequiredChecks = append(ch.RequiredChecks, check.Name)
+		if check.AppliesTo(ch.Target.Kind) {
+			ch.RequiredChecks = append(ch.RequiredChecks, check.Name)
+		}
 	}
 }
 
+func (c Check) AppliesTo(kind TargetKind) bool {
+	if len(c.Kinds) == 0 {
+		return true
+	}
+	for _, k := range c.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
 func (ch *Checker) PassCheck() {
 	pc := make([]uintptr, 15)
 	n := runtime.Callers(2, pc)
@@ -145,15 +341,40 @@ func (ch *Checker) FailCheck() {
 	ch.FailedChecks = append(ch.FailedChecks, functionName)
 }
 
+func (ch *Checker) SkipCheck() {
+	pc := make([]uintptr, 15)
+	n := runtime.Callers(2, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	frame, _ := frames.Next()
+	fullName := strings.Split(frame.Function, ".")
+	functionName := fullName[len(fullName)-1]
+	fmt.Printf(
+		"--- SKIP: %s\n", functionName,
+	)
+	ch.SkippedChecks = append(ch.SkippedChecks, functionName)
+}
+
 func (ch *Checker) CheckKubernetesRouteFromHost() {
 	PrintCheckHeader()
 	var err error
 	indent := 0
 	ch.KubernetesRoute = &KubernetesRoute{}
 	PrintHost(ch.Target)
-	ch.KubernetesRoute.Ingress, _ = ch.KubernetesComponents.FindIngressPathForHost(ch.Target)
+	target := ch.Target
+	var unmatchedRecords []*DnsRecord
+	for _, r := range ch.Target.Records {
+		ingressPath, servicePort := ch.KubernetesComponents.FindRouteForAddress(ch.Target, r.IpAddress)
+		PrintDnsRecordRoute(r, ingressPath, servicePort, 0)
+		if ingressPath == nil && servicePort == nil {
+			unmatchedRecords = append(unmatchedRecords, r)
+		} else if target == ch.Target {
+			target = ch.Target.ForAddress(r.IpAddress)
+		}
+	}
+	PrintIngressPathMatches(ch.KubernetesComponents.MatchIngressPaths(target))
+	ch.KubernetesRoute.Ingress, _ = ch.KubernetesComponents.FindIngressPathForHost(target)
 	if ch.KubernetesRoute.Ingress == nil {
-		ch.KubernetesRoute.Service, err = ch.KubernetesComponents.FindServicePortForHost(ch.Target)
+		ch.KubernetesRoute.Service, err = ch.KubernetesComponents.FindServicePortForHost(target)
 		if err != nil {
 			_ = level.Error(Logger).Log("msg", err)
 			ch.FailCheck()
@@ -192,44 +413,906 @@ func (ch *Checker) CheckKubernetesRouteFromHost() {
 	for _, p := range ch.KubernetesRoute.Pods {
 		PrintPodPort(p, indent)
 	}
+	if !ch.checkNamedTargetPort(ch.KubernetesRoute.Service) {
+		ch.FailCheck()
+		return
+	}
+	if len(unmatchedRecords) > 0 {
+		_ = level.Error(Logger).Log(
+			"msg",
+			fmt.Sprintf(
+				"%d of %d dns records for '%s' point at nothing in the cluster", len(unmatchedRecords), len(ch.Target.Records), ch.Target.Host))
+		ch.FailCheck()
+		return
+	}
 	ch.PassCheck()
 }
 
-func (ch *Checker) CheckStatusPod() {
+// CheckDnsResolvers compares the answers for the host from the system resolver and from each configured
+// nameserver, against the ingress and service addresses in the cluster. Split-horizon zones are expected to
+// disagree, but every answer should still point at something in the cluster.
+func (ch *Checker) CheckDnsResolvers() {
 	PrintCheckHeader()
-	if len(ch.KubernetesRoute.Pods) > 0 {
-		for _, p := range ch.KubernetesRoute.Pods {
-			if p.PodStatus != "Running" {
-				_ = level.Error(Logger).Log("msg", "Not all pods have a status of `Running`.")
-				ch.FailCheck()
-				return
+	if ch.Resolver == nil || len(ch.Resolver.Nameservers) == 0 {
+		ch.SkipCheck()
+		return
+	}
+	resolvers := []*Resolver{{Net: ch.Resolver.Net, Timeout: ch.Resolver.Timeout}}
+	for _, nameserver := range ch.Resolver.Nameservers {
+		resolvers = append(resolvers, &Resolver{Nameservers: []string{nameserver}, Net: ch.Resolver.Net, Timeout: ch.Resolver.Timeout})
+	}
+	failed := false
+	for _, resolver := range resolvers {
+		PrintSection(resolver.Name())
+		records, _, err := resolver.Resolve(ch.Target.Host)
+		if err != nil {
+			_ = level.Error(Logger).Log("msg", fmt.Sprintf("%s: %v", resolver.Name(), err))
+			failed = true
+			continue
+		}
+		for _, r := range records {
+			ingressPath, servicePort := ch.KubernetesComponents.FindRouteForAddress(ch.Target, r.IpAddress)
+			PrintDnsRecordRoute(r, ingressPath, servicePort, 3)
+			if ingressPath == nil && servicePort == nil {
+				failed = true
 			}
 		}
+	}
+	if failed {
+		_ = level.Error(Logger).Log("msg", fmt.Sprintf("Not every nameserver resolves '%s' to an address in the cluster.", ch.Target.Host))
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+func (ch *Checker) CheckKubernetesRouteFromPod() {
+	PrintCheckHeader()
+	var err error
+	indent := 0
+	ch.KubernetesRoute = &KubernetesRoute{}
+	PrintPodTarget(ch.Target)
+	podPort, err := ch.KubernetesComponents.FindPodPort(ch.Target)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		ch.FailCheck()
+		return
+	}
+	ch.KubernetesRoute.Pods = []*PodPort{podPort}
+	PrintPodPort(podPort, indent)
+	indent = indent + 3
+	ch.KubernetesRoute.Service, err = ch.KubernetesComponents.FindServicePortForPodPort(podPort)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		ch.FailCheck()
+		return
+	}
+	PrintServicePort(ch.KubernetesRoute.Service, indent)
+	indent = indent + 3
+	// Services without an ingress, such as internal ClusterIP services, are still a complete route.
+	ingressPaths, _ := ch.KubernetesComponents.FindIngressPathForServicePort(ch.KubernetesRoute.Service)
+	if len(ingressPaths) == 0 {
+		PrintNoIngress(indent)
+	}
+	for _, i := range ingressPaths {
+		PrintIngressPath(i, indent)
+	}
+	if len(ingressPaths) == 1 {
+		ch.KubernetesRoute.Ingress = ingressPaths[0]
+	}
+	ch.PassCheck()
+}
+
+func (ch *Checker) CheckKubernetesRouteFromService() {
+	PrintCheckHeader()
+	var err error
+	ch.KubernetesRoute = &KubernetesRoute{}
+	PrintServiceTarget(ch.Target)
+	ch.KubernetesRoute.Service, err = ch.KubernetesComponents.FindServicePort(ch.Target)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		ch.FailCheck()
+		return
+	}
+	PrintSection("upstream")
+	ingressPaths, _ := ch.KubernetesComponents.FindIngressPathForServicePort(ch.KubernetesRoute.Service)
+	for _, i := range ingressPaths {
+		PrintIngressPath(i, 3)
+	}
+	if len(ingressPaths) == 1 {
+		ch.KubernetesRoute.Ingress = ingressPaths[0]
+	}
+	PrintSection("downstream")
+	PrintServicePort(ch.KubernetesRoute.Service, 3)
+	ch.KubernetesRoute.Pods, err = ch.KubernetesComponents.FindPodPortForServicePort(ch.KubernetesRoute.Service)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		ch.FailCheck()
+		return
+	}
+	for _, p := range ch.KubernetesRoute.Pods {
+		PrintPodPort(p, 6)
+	}
+	if !ch.checkNamedTargetPort(ch.KubernetesRoute.Service) {
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+func (ch *Checker) CheckKubernetesRouteFromInternalHost() {
+	PrintCheckHeader()
+	var err error
+	ch.KubernetesRoute = &KubernetesRoute{}
+	PrintInternalHost(ch.Target)
+	if ch.Target.Name == "" {
+		var podPort *PodPort
+		podPort, err = ch.KubernetesComponents.FindPodPortForIp(ch.Target)
+		if err != nil {
+			_ = level.Error(Logger).Log("msg", err)
+			ch.FailCheck()
+			return
+		}
+		ch.KubernetesRoute.Pods = []*PodPort{podPort}
+		PrintPodPort(podPort, 0)
+		ch.PassCheck()
+		return
+	}
+	ch.KubernetesRoute.Service, err = ch.KubernetesComponents.FindServicePort(ch.Target)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		ch.FailCheck()
+		return
+	}
+	PrintServicePort(ch.KubernetesRoute.Service, 0)
+	if ch.Target.Hostname != "" {
+		ch.KubernetesRoute.Pods, err = ch.KubernetesComponents.FindPodPortForHostname(ch.KubernetesRoute.Service, ch.Target.Hostname)
 	} else {
+		ch.KubernetesRoute.Pods, err = ch.KubernetesComponents.FindPodPortForServicePort(ch.KubernetesRoute.Service)
+	}
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		ch.FailCheck()
+		return
+	}
+	for _, p := range ch.KubernetesRoute.Pods {
+		PrintPodPort(p, 3)
+	}
+	if !ch.checkNamedTargetPort(ch.KubernetesRoute.Service) {
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+// checkNamedTargetPort flags pods selected by the service that have no container port matching its named
+// target port, as kube-proxy has nowhere to send their share of the traffic.
+func (ch *Checker) checkNamedTargetPort(s *ServicePort) bool {
+	podNames := ch.KubernetesComponents.FindPodsMissingTargetPort(s)
+	for _, podName := range podNames {
+		_ = level.Error(Logger).Log(
+			"msg",
+			fmt.Sprintf(
+				"Pod '%v' is selected by service '%v' but has no container port named '%v'", podName, s.ServiceName, s.TargetPortName))
+	}
+	return len(podNames) == 0
+}
+
+// CheckEndpointsService compares the endpoints Kubernetes publishes for the service, which is what kube-proxy
+// is programmed with, against the pods the service selector matches.
+func (ch *Checker) CheckEndpointsService() {
+	PrintCheckHeader()
+	if ch.KubernetesRoute == nil || ch.KubernetesRoute.Service == nil {
+		ch.SkipCheck()
+		return
+	}
+	s := ch.KubernetesRoute.Service
+	for _, e := range s.Endpoints {
+		PrintServiceEndpoint(e, 0)
+	}
+	failed := false
+	if len(s.ReadyEndpoints()) == 0 {
+		_ = level.Error(Logger).Log("msg", fmt.Sprintf("Service '%v' has no ready endpoints.", s.ServiceName))
+		failed = true
+	}
+	if len(s.Selector) > 0 {
+		missingPods, unexpectedEndpoints := ch.KubernetesComponents.FindEndpointMismatches(s)
+		for _, p := range missingPods {
+			_ = level.Error(Logger).Log(
+				"msg",
+				fmt.Sprintf(
+					"Pod '%v' is selected by service '%v' but is not published as an endpoint", p.Name, s.ServiceName))
+			failed = true
+		}
+		for _, e := range unexpectedEndpoints {
+			_ = level.Error(Logger).Log(
+				"msg",
+				fmt.Sprintf(
+					"Endpoint %v of service '%v' is not a pod matching the service selector", e.IpAddress, s.ServiceName))
+			failed = true
+		}
+	}
+	if failed {
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+// CheckStatusPod reports every pod on the route that is not running and ready, with the reason it is unhealthy.
+func (ch *Checker) CheckStatusPod() {
+	PrintCheckHeader()
+	if len(ch.KubernetesRoute.Pods) == 0 {
 		_ = level.Error(Logger).Log("msg", "No pods were found.")
 		ch.FailCheck()
 		return
 	}
+	healthy := make(map[string]bool)
+	for _, p := range ch.KubernetesRoute.Pods {
+		result := ch.KubernetesRoute.podResult(p)
+		result.Problems = p.HealthProblems()
+		if len(result.Problems) == 0 {
+			healthy[p.key()] = true
+		}
+	}
+	PrintPodResults(ch.KubernetesRoute.PodResults)
+	if !ch.meetsPodThreshold(len(healthy), "healthy") {
+		ch.FailCheck()
+		return
+	}
 	ch.PassCheck()
 }
 
 func (ch *Checker) CheckListeningPod() {
 	PrintCheckHeader()
-	if len(ch.KubernetesRoute.Pods) > 0 {
-		for _, p := range ch.KubernetesRoute.Pods {
-			if !ch.Client.IsPodListening(p) {
-				_ = level.Error(Logger).Log(
-					"msg",
-					fmt.Sprintf(
-						"Pod '%v' is not accepting connections on port: %v", p.PodName, p.ContainerPort))
+	if len(ch.KubernetesRoute.Pods) == 0 {
+		_ = level.Error(Logger).Log("msg", "No pods were found.")
+		ch.FailCheck()
+		return
+	}
+	// A pod matched on several ports only counts as listening when every port accepts connections.
+	notListening := make(map[string]bool)
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	slots := make(chan struct{}, maxConcurrentForwards)
+	for _, p := range ch.KubernetesRoute.Pods {
+		result := ch.KubernetesRoute.podResult(p)
+		probe := ch.PodProbe(p)
+		wait.Add(1)
+		go func(p *PodPort) {
+			defer wait.Done()
+			slots <- struct{}{}
+			probeResult, ok := ch.Client.IsPodListening(p, probe)
+			<-slots
+			mutex.Lock()
+			defer mutex.Unlock()
+			if ok {
+				result.Listening = fmt.Sprintf("yes, %s (%s)", probe.Protocol, probeResult)
+			} else {
+				result.Listening = fmt.Sprintf("no, %s (%s)", probe.Protocol, probeResult)
+				notListening[p.key()] = true
+			}
+		}(p)
+	}
+	wait.Wait()
+	PrintPodResults(ch.KubernetesRoute.PodResults)
+	if !ch.meetsPodThreshold(ch.KubernetesRoute.podCount()-len(notListening), "accepting connections") {
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+// PodProbe picks how a pod is probed: the --probe protocol, then an explicit target url scheme, then the service
+// appProtocol, then the service and pod port names, falling back to a tcp connect. The scheme is only used when the
+// route has no ingress, as an ingress may terminate TLS or speak a different protocol to the pods.
+func (ch *Checker) PodProbe(p *PodPort) *PortProbe {
+	probe := PortProbe{Protocol: ProbeTcp}
+	if ch.Probe != nil {
+		probe = *ch.Probe
+	}
+	if ch.Target.ExplicitScheme {
+		probe.Host, probe.Path = ch.Target.Host, ch.Target.Path
+	}
+	if ch.Probe != nil && ch.Probe.Protocol != "" {
+		return &probe
+	}
+	var names []string
+	if ch.Target.ExplicitScheme && ch.KubernetesRoute.Ingress == nil {
+		names = append(names, ch.Target.Scheme)
+	}
+	if s := ch.KubernetesRoute.Service; s != nil {
+		names = append(names, s.AppProtocol, s.SourcePortName)
+	}
+	names = append(names, p.PortName)
+	for _, name := range names {
+		if protocol, ok := ProbeProtocolFor(name); ok {
+			probe.Protocol = protocol
+			return &probe
+		}
+	}
+	probe.Protocol = ProbeTcp
+	return &probe
+}
+
+// meetsPodThreshold reports whether enough of the pods on the route passed, logging the shortfall when not.
+func (ch *Checker) meetsPodThreshold(passed int, state string) bool {
+	threshold := ch.PodThreshold
+	if threshold == 0 {
+		threshold = DefaultPodThreshold
+	}
+	total := ch.KubernetesRoute.podCount()
+	if float64(passed)*100 >= threshold*float64(total) {
+		return true
+	}
+	_ = level.Error(Logger).Log(
+		"msg",
+		fmt.Sprintf(
+			"%d of %d pods are %s, below the %v%% threshold", passed, total, state, threshold))
+	return false
+}
+
+// podCount counts the distinct pods on the route, which has an entry per pod port.
+func (r *KubernetesRoute) podCount() int {
+	pods := make(map[string]bool)
+	for _, p := range r.Pods {
+		pods[p.key()] = true
+	}
+	return len(pods)
+}
+
+func (r *KubernetesRoute) podResult(p *PodPort) *PodResult {
+	for _, result := range r.PodResults {
+		if result.PodPort == p {
+			return result
+		}
+	}
+	result := &PodResult{PodPort: p}
+	r.PodResults = append(r.PodResults, result)
+	return result
+}
+
+func (r *PodResult) Status() string {
+	if len(r.Problems) == 0 {
+		return "healthy"
+	}
+	return strings.Join(r.Problems, "; ")
+}
+
+func (ch *Checker) CheckListeningHost() {
+	PrintCheckHeader()
+	if len(ch.Target.Records) == 0 {
+		_ = level.Error(Logger).Log("msg", "No addresses were resolved for the host.")
+		ch.FailCheck()
+		return
+	}
+	if ch.Target.Scheme != "http" && ch.Target.Scheme != "https" {
+		if !ch.probeHostPort() {
+			ch.FailCheck()
+			return
+		}
+		ch.PassCheck()
+		return
+	}
+	failed := false
+	for _, r := range ch.Target.Records {
+		response, err := ch.Target.ForAddress(r.IpAddress).Probe()
+		if err != nil {
+			_ = level.Error(Logger).Log(
+				"msg",
+				fmt.Sprintf(
+					"Host '%s' is not accepting connections on %s: %v", ch.Target.Host, r.IpAddress, err))
+			failed = true
+			continue
+		}
+		PrintHostProbe(ch.Target, r, response)
+	}
+	if failed {
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+// CheckNetworkPoliciesPod evaluates the network policies between the --from source, and the ingress controller
+// pods when the route goes through an ingress, and every pod on the route. An address or cidr source is evaluated
+// against the pods that see it as the source of the traffic.
+func (ch *Checker) CheckNetworkPoliciesPod() {
+	PrintCheckHeader()
+	if ch.KubernetesRoute == nil || len(ch.KubernetesRoute.Pods) == 0 {
+		ch.SkipCheck()
+		return
+	}
+	if ch.KubernetesComponents.NetworkPolicyErr != nil {
+		_ = level.Error(Logger).Log(
+			"msg",
+			fmt.Sprintf(
+				"Network policies can't be evaluated, listing them failed: %v", ch.KubernetesComponents.NetworkPolicyErr))
+		ch.SkipCheck()
+		return
+	}
+	sources, err := ch.trafficSources()
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		ch.FailCheck()
+		return
+	}
+	if len(sources) == 0 {
+		ch.SkipCheck()
+		return
+	}
+	failed := false
+	for _, source := range sources {
+		PrintSection(fmt.Sprintf("from %s", source.Description))
+		podPorts := ch.KubernetesRoute.Pods
+		if source.Cidr != nil {
+			var reason string
+			podPorts, reason = ch.clientAddressDestinations()
+			if reason != "" {
+				PrintNotEvaluated(reason, 3)
+				continue
+			}
+		}
+		for _, p := range podPorts {
+			verdict := ch.KubernetesComponents.EvaluateNetworkPolicies(source, p)
+			PrintPolicyVerdict(verdict, 3)
+			if !verdict.Allowed {
+				failed = true
+			}
+		}
+	}
+	if failed {
+		_ = level.Error(Logger).Log("msg", "Network policies deny traffic to some pods on the route.")
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+// trafficSources returns the sources network policies are evaluated for.
+func (ch *Checker) trafficSources() (sources []*TrafficSource, err error) {
+	if ch.Source != nil {
+		switch ch.Source.Kind {
+		case PodTarget:
+			var pod *v1.Pod
+			pod, err = ch.Client.CoreV1().Pods(ch.Source.Namespace).Get(ch.Source.Name, metav1.GetOptions{})
+			if err != nil {
+				return
+			}
+			sources = append(sources, PodTrafficSource(pod))
+		case NamespaceTarget:
+			sources = append(sources, &TrafficSource{Description: "namespace " + ch.Source.Namespace, Namespace: ch.Source.Namespace})
+		case CidrTarget:
+			sources = append(sources, &TrafficSource{Description: ch.Source.Cidr.String(), Cidr: ch.Source.Cidr})
+		}
+	}
+	if ch.KubernetesRoute.Ingress != nil {
+		sources = append(sources, ch.KubernetesComponents.FindIngressControllerPods(ch.KubernetesRoute.Ingress)...)
+	}
+	return
+}
+
+// clientAddressDestinations returns the pod ports that see the address of a client outside the cluster as the
+// source of its traffic: the ingress controller pods when the route goes through an ingress, and otherwise the
+// pods on the route. A LoadBalancer or NodePort service with the Cluster external traffic policy replaces the
+// client address with a node address, so the reason no pod sees it is returned instead.
+func (ch *Checker) clientAddressDestinations() (podPorts []*PodPort, reason string) {
+	podPorts = ch.KubernetesRoute.Pods
+	entry := ch.KubernetesRoute.Service
+	if i := ch.KubernetesRoute.Ingress; i != nil {
+		controllerPods := ch.KubernetesComponents.FindIngressPathControllerPodPorts(i)
+		if len(controllerPods) == 0 {
+			return nil, fmt.Sprintf("the pods of the controller serving ingress %s weren't found", i.IngressName)
+		}
+		podPorts = controllerPods
+		entry = ch.KubernetesComponents.FindControllerLoadBalancer(ch.Target, controllerPods)
+		if entry != nil {
+			if entryPods, err := ch.KubernetesComponents.FindPodPortForServicePort(entry); err == nil {
+				podPorts = entryPods
+			}
+		}
+	}
+	if entry != nil &&
+		(entry.Type == string(v1.ServiceTypeLoadBalancer) || entry.Type == string(v1.ServiceTypeNodePort)) &&
+		entry.ExternalTrafficPolicy != string(v1.ServiceExternalTrafficPolicyTypeLocal) {
+		return nil, fmt.Sprintf(
+			"service %s.%s doesn't have the Local external traffic policy, so pods see a node address instead of the client address",
+			entry.ServiceName, entry.Namespace)
+	}
+	return
+}
+
+// CheckSourceRangesService checks the originating IP is inside the source ranges of the LoadBalancer services on
+// the route.
+func (ch *Checker) CheckSourceRangesService() {
+	PrintCheckHeader()
+	var routeService *ServicePort
+	if ch.KubernetesRoute != nil {
+		routeService = ch.KubernetesRoute.Service
+	}
+	servicePorts := ch.KubernetesComponents.FindLoadBalancerServicePorts(ch.Target, routeService)
+	if len(servicePorts) == 0 {
+		ch.SkipCheck()
+		return
+	}
+	failed := false
+	for _, s := range servicePorts {
+		ranges, err := ParseSourceRanges(s.SourceRanges)
+		if err != nil {
+			_ = level.Error(Logger).Log("msg", fmt.Sprintf("Service '%s' has %v", s.ServiceName, err))
+			failed = true
+			continue
+		}
+		var originIp net.IP
+		if len(ranges) > 0 {
+			originIp, err = ch.OriginIp()
+			if err != nil {
+				_ = level.Error(Logger).Log("msg", err)
 				ch.FailCheck()
 				return
 			}
 		}
+		verdict := EvaluateSourceRanges(ranges, originIp)
+		PrintServiceSourceRanges(s, verdict, 0)
+		if !verdict.Allowed {
+			_ = level.Error(Logger).Log(
+				"msg",
+				fmt.Sprintf("Originating IP %s is outside the source ranges of service '%s'.", originIp, s.ServiceName))
+			failed = true
+		}
+	}
+	if failed {
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+// CheckSourceRangesIngress checks the ingress controller lets the originating IP through the source range
+// annotations and Traefik IP allow lists of the route's ingress, using the address the controller sees.
+func (ch *Checker) CheckSourceRangesIngress() {
+	PrintCheckHeader()
+	if ch.KubernetesRoute == nil || ch.KubernetesRoute.Ingress == nil {
+		ch.SkipCheck()
+		return
+	}
+	ingress := ch.KubernetesRoute.Ingress
+	rules := ch.KubernetesComponents.IngressSourceRangeRules(ingress)
+	if len(rules) == 0 {
+		PrintSection(fmt.Sprintf("ingress %s.%s has no source ranges, open to every address", ingress.IngressName, ingress.Namespace))
+		ch.PassCheck()
+		return
+	}
+	originIp, err := ch.OriginIp()
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		ch.FailCheck()
+		return
+	}
+	controller := IngressControllerFor(ingress)
+	pods := ch.KubernetesComponents.FindIngressPathControllerPodPorts(ingress)
+	var args []string
+	for _, p := range pods {
+		args = append(args, p.Args...)
+	}
+	var nginxConfig map[string]string
+	if controller == IngressControllerNginx {
+		nginxConfig, err = ch.Client.IngressNginxConfig(pods)
+		if err != nil {
+			_ = level.Error(Logger).Log("msg", fmt.Sprintf("Could not read the ingress-nginx configmap: %v", err))
+		}
+	}
+	lb := ch.KubernetesComponents.FindControllerLoadBalancer(ch.Target, pods)
+	seesOriginIp, clientAddress := ControllerClientAddress(controller, args, nginxConfig, lb)
+	verdict, err := EvaluateIngressSourceRanges(rules, originIp, seesOriginIp)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		ch.FailCheck()
+		return
+	}
+	PrintIngressSourceRanges(ingress, clientAddress, verdict, 0)
+	if !verdict.Allowed {
+		_ = level.Error(Logger).Log(
+			"msg",
+			fmt.Sprintf("Ingress '%s' would reject requests from %s with 403 Forbidden.", ingress.IngressName, originIp))
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+// CheckStatusNginxIngress checks the ingress-nginx controller serving the route's ingress: its workload and pods
+// are ready, every pod answers /healthz, and its LoadBalancer service is exposed on the ingress status address.
+func (ch *Checker) CheckStatusNginxIngress() {
+	PrintCheckHeader()
+	if ch.KubernetesRoute == nil || ch.KubernetesRoute.Ingress == nil {
+		ch.SkipCheck()
+		return
+	}
+	ingress := ch.KubernetesRoute.Ingress
+	pods := ch.KubernetesComponents.FindIngressNginxPods(ingress)
+	if len(pods) == 0 {
+		if IngressControllerFor(ingress) != IngressControllerNginx {
+			ch.SkipCheck()
+			return
+		}
+		_ = level.Error(Logger).Log(
+			"msg",
+			fmt.Sprintf("No ingress-nginx controller pods were found for ingress class '%s'.", ingress.IngressClassName))
+		ch.FailCheck()
+		return
+	}
+	failed := !ch.controllerWorkloadsReady(pods)
+	if !ch.controllerPodsHealthy(pods, NginxHealthzPort, nginxHealthzPath) {
+		failed = true
+	}
+	lb := ch.KubernetesComponents.FindControllerLoadBalancer(ch.Target, pods)
+	if lb == nil {
+		PrintSection("no LoadBalancer service was found in front of the controller")
 	} else {
-		_ = level.Error(Logger).Log("msg", "No pods were found.")
+		PrintServicePort(lb, 0)
+		matches, reason := LoadBalancerMatchesIngress(lb, ingress)
+		if !matches {
+			_ = level.Error(Logger).Log("msg", reason)
+			failed = true
+		}
+	}
+	if failed {
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+// CheckStatusTraefikIngress checks the Traefik pods serving the route's ingress or IngressRoute are ready and
+// answer /ping, and that each has loaded a router for the route without errors, using the Traefik API.
+func (ch *Checker) CheckStatusTraefikIngress() {
+	PrintCheckHeader()
+	if ch.KubernetesRoute == nil || ch.KubernetesRoute.Ingress == nil || IngressControllerFor(ch.KubernetesRoute.Ingress) != IngressControllerTraefik {
+		ch.SkipCheck()
+		return
+	}
+	ingress := ch.KubernetesRoute.Ingress
+	pods := ch.KubernetesComponents.FindTraefikPods()
+	if len(pods) == 0 {
+		_ = level.Error(Logger).Log("msg", "No traefik pods were found.")
+		ch.FailCheck()
+		return
+	}
+	failed := !ch.controllerWorkloadsReady(pods)
+	if !ch.controllerPodsHealthy(pods, traefikPingPort, traefikPingPath) {
+		failed = true
+	}
+	for _, p := range pods {
+		PrintSection(fmt.Sprintf("routers on pod %s", p.PodName))
+		routers, err := ch.Client.GetTraefikRouters(p)
+		if err != nil {
+			_ = level.Error(Logger).Log("msg", err)
+			failed = true
+			continue
+		}
+		matches := MatchTraefikRouters(routers, ingress)
+		if len(matches) == 0 {
+			_ = level.Error(Logger).Log(
+				"msg",
+				fmt.Sprintf("Pod '%s' has not loaded a router for %s '%s'.", p.PodName, ingressKind(ingress), ingress.IngressName))
+			failed = true
+		}
+		for _, r := range matches {
+			PrintTraefikRouter(r, 3)
+			if r.Status != traefikRouterEnabled || len(r.Errors) > 0 {
+				failed = true
+			}
+		}
+	}
+	if failed {
 		ch.FailCheck()
 		return
 	}
 	ch.PassCheck()
 }
+
+// controllerWorkloadsReady prints the Deployments and DaemonSets running the controller pods, reporting whether
+// every one has all its pods ready.
+func (ch *Checker) controllerWorkloadsReady(pods []*PodPort) (ready bool) {
+	workloads, err := ch.Client.FindControllerWorkloads(pods)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		return false
+	}
+	ready = true
+	for _, w := range workloads {
+		PrintControllerWorkload(w, 0)
+		if w.Ready < w.Desired {
+			_ = level.Error(Logger).Log(
+				"msg",
+				fmt.Sprintf("%s '%s' has %d of %d pods ready.", w.Kind, w.Name, w.Ready, w.Desired))
+			ready = false
+		}
+	}
+	return
+}
+
+// controllerPodsHealthy requests the health path of each controller pod on the port returned by healthPort,
+// printing the results and reporting whether every pod is healthy. Pods the port is 0 for don't serve the path
+// and are only judged on their container health.
+func (ch *Checker) controllerPodsHealthy(pods []*PodPort, healthPort func(p *PodPort) int32, path string) (healthy bool) {
+	healthy = true
+	var results []*PodResult
+	for _, p := range pods {
+		result := &PodResult{PodPort: p, Problems: p.HealthProblems()}
+		if len(result.Problems) > 0 {
+			healthy = false
+		}
+		if port := healthPort(p); port != 0 {
+			body, ok := ch.Client.GetHealthz(p, port, path)
+			if ok {
+				result.Listening = fmt.Sprintf("yes, %s (%s)", path, body)
+			} else {
+				result.Listening = fmt.Sprintf("no, %s (%s)", path, body)
+				healthy = false
+			}
+		}
+		results = append(results, result)
+	}
+	PrintPodResults(results)
+	return
+}
+
+// CheckStatusKubeDns checks the kube-dns pods are ready and its endpoints populated, then queries each pod over a
+// port-forward for the route's in-cluster names and compares the answers with the service ClusterIPs.
+func (ch *Checker) CheckStatusKubeDns() {
+	PrintCheckHeader()
+	servicePorts := ch.KubernetesComponents.FindKubeDnsServicePorts()
+	if len(servicePorts) == 0 {
+		PrintSection(fmt.Sprintf("no %s service was found in %s, nor any labelled %s=%s", kubeDnsServiceName, kubeDnsNamespace, kubeDnsLabel, kubeDnsServiceName))
+		ch.SkipCheck()
+		return
+	}
+	serviceName := servicePorts[0].ServiceName
+	failed := false
+	for _, s := range servicePorts {
+		if len(s.ReadyEndpoints()) == 0 {
+			_ = level.Error(Logger).Log(
+				"msg",
+				fmt.Sprintf("Service '%s' has no ready endpoints for port %d/%s.", s.ServiceName, s.SourcePort, s.Protocol))
+			failed = true
+		}
+	}
+	tcpPort := KubeDnsTcpPort(servicePorts)
+	if tcpPort == nil {
+		_ = level.Error(Logger).Log("msg", fmt.Sprintf("Service '%s' has no TCP port %d to query.", serviceName, kubeDnsPort))
+		ch.FailCheck()
+		return
+	}
+	PrintServicePort(tcpPort, 0)
+	pods, err := ch.KubernetesComponents.FindPodPortForServicePort(tcpPort)
+	if err != nil || len(pods) == 0 {
+		_ = level.Error(Logger).Log("msg", fmt.Sprintf("No pods were found for service '%s'.", serviceName))
+		ch.FailCheck()
+		return
+	}
+	clusterDomain := ch.ClusterDomain
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+	queries := ch.KubernetesComponents.ClusterDnsQueries(ch.Target, ch.KubernetesRoute, clusterDomain)
+	var results []*PodResult
+	for _, p := range pods {
+		result := &PodResult{PodPort: p, Problems: p.HealthProblems()}
+		results = append(results, result)
+		if len(result.Problems) > 0 {
+			failed = true
+			continue
+		}
+		answered := 0
+		for _, q := range queries {
+			answers, err := ch.Client.ResolveThroughPod(p, q.Name)
+			if err != nil {
+				_ = level.Error(Logger).Log("msg", fmt.Sprintf("Pod '%s' could not resolve %s: %v", p.PodName, q.Name, err))
+				continue
+			}
+			PrintClusterDnsAnswer(p, q, answers, 0)
+			missing, unexpected := q.Compare(answers)
+			if len(missing) > 0 || len(unexpected) > 0 {
+				_ = level.Error(Logger).Log(
+					"msg",
+					fmt.Sprintf("Pod '%s' answered %s with %s, expected %s.", p.PodName, q.Name, joinIPs(answers), joinIPs(q.Expected)))
+				continue
+			}
+			answered++
+		}
+		result.Listening = fmt.Sprintf("yes, %d of %d queries answered as expected", answered, len(queries))
+		if answered < len(queries) {
+			result.Listening = fmt.Sprintf("no, %d of %d queries answered as expected", answered, len(queries))
+			failed = true
+		}
+	}
+	PrintPodResults(results)
+	if failed {
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+// CheckKubernetesRoutePodToPod connects from inside the --from pod to the service DNS name, the ClusterIP and
+// every pod IP on the route, to show which layer in-cluster traffic fails at.
+func (ch *Checker) CheckKubernetesRoutePodToPod() {
+	PrintCheckHeader()
+	if ch.Source == nil || ch.Source.Kind != PodTarget {
+		ch.SkipCheck()
+		return
+	}
+	clusterDomain := ch.ClusterDomain
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+	probes := PodToPodProbes(ch.KubernetesRoute.Service, ch.KubernetesRoute.Pods, clusterDomain)
+	if len(probes) == 0 {
+		_ = level.Error(Logger).Log("msg", "No service or pods were found on the route to connect to.")
+		ch.FailCheck()
+		return
+	}
+	debugImage := ch.DebugImage
+	if debugImage == "" {
+		debugImage = DefaultDebugImage
+	}
+	exec, err := ch.Client.SourceExec(ch.Source, debugImage, ch.DebugContainer)
+	if err == errSourceHasNoTools {
+		PrintNotEvaluated(fmt.Sprintf("%v, rerun with --debug-container to attach an ephemeral %s container, which stays in the pod spec", err, debugImage), 0)
+		ch.SkipCheck()
+		return
+	}
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		ch.FailCheck()
+		return
+	}
+	PrintSection(fmt.Sprintf("from pod/%s.%s (container %s)", exec.PodName, exec.Namespace, exec.Container))
+	for _, pr := range probes {
+		pr.Output, err = exec.Run(pr.Command)
+		pr.Reachable = err == nil
+		if err != nil {
+			pr.Output = err.Error()
+		}
+		PrintPodToPodProbe(pr, 3)
+	}
+	diagnosis, ok := DiagnosePodToPod(probes)
+	if !ok {
+		_ = level.Error(Logger).Log("msg", diagnosis)
+		ch.FailCheck()
+		return
+	}
+	ch.PassCheck()
+}
+
+// probeHostPort probes hosts with a non-http scheme, such as tcp:// or grpc://, on each resolved address.
+func (ch *Checker) probeHostPort() bool {
+	probe := PortProbe{Host: ch.Target.Host, Path: ch.Target.Path}
+	if ch.Probe != nil {
+		probe.Send, probe.Expect = ch.Probe.Send, ch.Probe.Expect
+	}
+	protocol, ok := ProbeProtocolFor(ch.Target.Scheme)
+	if !ok {
+		protocol = ProbeTcp
+	}
+	probe.Protocol = protocol
+	if ch.Probe != nil && ch.Probe.Protocol != "" {
+		probe.Protocol = ch.Probe.Protocol
+	}
+	failed := false
+	for _, r := range ch.Target.Records {
+		result, err := probe.Run(net.JoinHostPort(r.IpAddress.String(), strconv.Itoa(int(ch.Target.Port))))
+		if err != nil {
+			_ = level.Error(Logger).Log(
+				"msg",
+				fmt.Sprintf(
+					"Host '%s' is not accepting %s connections on %s: %v", ch.Target.Host, probe.Protocol, r.IpAddress, err))
+			failed = true
+			continue
+		}
+		PrintHostPortProbe(ch.Target, r, result)
+	}
+	return !failed
+}
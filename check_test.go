@@ -4,6 +4,11 @@ import (
 	"fmt"
 	"github.com/stevenayers/netkat"
 	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
 )
 
 type (
@@ -14,6 +19,24 @@ type (
 		Path   string
 	}
 
+	ResourceTargetTest struct {
+		RawTarget string
+		Kind      netkat.TargetKind
+		Name      string
+		Namespace string
+		Port      int32
+		PortName  string
+	}
+
+	InternalHostTest struct {
+		RawUrl    string
+		Name      string
+		Namespace string
+		Hostname  string
+		IpAddress string
+		Port      int32
+	}
+
 	PodTest struct {
 		PodPort  netkat.PodPort
 		Expected int
@@ -38,6 +61,22 @@ var (
 		{"http://google.com:8000/path", "google.com", 8000, "/path"},
 		{"google.com:8000/path", "google.com", 8000, "/path"},
 	}
+
+	ResourceTargetTests = []ResourceTargetTest{
+		{"pod/grafana-fb86ad62c-f63x9:3000", netkat.PodTarget, "grafana-fb86ad62c-f63x9", "", 3000, ""},
+		{"pod/grafana-fb86ad62c-f63x9.metrics:3000", netkat.PodTarget, "grafana-fb86ad62c-f63x9", "metrics", 3000, ""},
+		{"pod/node-exporter.ip-10-0-1-5.metrics:9100", netkat.PodTarget, "node-exporter.ip-10-0-1-5", "metrics", 9100, ""},
+		{"svc/grafana-service.metrics:80", netkat.ServiceTarget, "grafana-service", "metrics", 80, ""},
+		{"svc/grafana-service.metrics:http", netkat.ServiceTarget, "grafana-service", "metrics", 0, "http"},
+		{"service/grafana-service:http", netkat.ServiceTarget, "grafana-service", "", 0, "http"},
+	}
+
+	InternalHostTests = []InternalHostTest{
+		{"web.default.svc.cluster.local", "web", "default", "", "", 80},
+		{"http://web.default.svc:8080", "web", "default", "", "", 8080},
+		{"web-0.web.default.svc.cluster.local:8080", "web", "default", "web-0", "", 8080},
+		{"10-1-2-3.default.pod.cluster.local:8080", "", "default", "", "10.1.2.3", 8080},
+	}
 )
 
 func (s *StoreSuite) TestTarget() {
@@ -50,11 +89,93 @@ func (s *StoreSuite) TestTarget() {
 		assert.Equal(s.T(), test.Host, r.Target.Host)
 		assert.Equal(s.T(), test.Port, r.Target.Port)
 		assert.Equal(s.T(), test.Path, r.Target.Path)
-		fmt.Println(r.Target.IpAddress.String())
+		assert.NotEmpty(s.T(), r.Target.Records, "Expected target to resolve to at least one record")
+		for _, record := range r.Target.Records {
+			fmt.Println(record.Type, record.IpAddress.String(), record.Ttl)
+		}
 	}
 
 }
 
+func (s *StoreSuite) TestResourceTarget() {
+	for _, test := range ResourceTargetTests {
+		var r netkat.Checker
+		err := r.ParseTarget(test.RawTarget)
+		if err != nil {
+			s.T().Fatal(err)
+		}
+		assert.Equal(s.T(), test.Kind, r.Target.Kind)
+		assert.Equal(s.T(), test.Name, r.Target.Name)
+		assert.Equal(s.T(), test.Namespace, r.Target.Namespace)
+		assert.Equal(s.T(), test.Port, r.Target.Port)
+		assert.Equal(s.T(), test.PortName, r.Target.PortName)
+		assert.Nil(s.T(), r.Target.IpAddress, "Expected resource targets to skip DNS resolution")
+	}
+	var r netkat.Checker
+	assert.Error(s.T(), r.ParseTarget("pod/grafana-fb86ad62c-f63x9"), "Expected pod target without a port to fail")
+}
+
+func (s *StoreSuite) TestInternalHostTarget() {
+	for _, test := range InternalHostTests {
+		var r netkat.Checker
+		err := r.ParseTarget(test.RawUrl)
+		if err != nil {
+			s.T().Fatal(err)
+		}
+		assert.Equal(s.T(), netkat.InternalHostTarget, r.Target.Kind)
+		assert.Equal(s.T(), test.Name, r.Target.Name)
+		assert.Equal(s.T(), test.Namespace, r.Target.Namespace)
+		assert.Equal(s.T(), test.Hostname, r.Target.Hostname)
+		assert.Equal(s.T(), test.Port, r.Target.Port)
+		if test.IpAddress != "" {
+			assert.Equal(s.T(), test.IpAddress, r.Target.IpAddress.String())
+		}
+	}
+	r := netkat.Checker{ClusterDomain: "corp.internal"}
+	err := r.ParseTarget("web.default.svc.corp.internal")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.Equal(s.T(), netkat.InternalHostTarget, r.Target.Kind)
+}
+
+func (s *StoreSuite) TestResolveOverride() {
+	override, err := netkat.ParseResolveOverride("hello-world.info:443:10.0.0.1,[::1]")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.Equal(s.T(), int32(443), override.Port)
+	assert.Equal(s.T(), 2, len(override.IpAddresses))
+	for _, invalid := range []string{"hello-world.info:10.0.0.1", "hello-world.info:https:10.0.0.1", "hello-world.info:443:not-an-ip"} {
+		_, err = netkat.ParseResolveOverride(invalid)
+		assert.Error(s.T(), err, invalid)
+	}
+	ch := netkat.Checker{ResolveOverrides: []*netkat.ResolveOverride{override}}
+	err = ch.ParseTarget("https://hello-world.info/path")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.Equal(s.T(), "10.0.0.1", ch.Target.IpAddress.String())
+	assert.Equal(s.T(), "override", ch.Target.Records[0].Type)
+}
+
+func (s *StoreSuite) TestProbeSendsHostHeader() {
+	var host string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host = r.Host
+	}))
+	defer server.Close()
+	serverUrl, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(serverUrl.Port())
+	target := netkat.Target{Scheme: "http", Host: "hello-world.info", Port: int32(port), Path: "/", IpAddress: net.ParseIP("127.0.0.1")}
+	response, err := target.Probe()
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.Equal(s.T(), http.StatusOK, response.StatusCode)
+	assert.Equal(s.T(), fmt.Sprintf("hello-world.info:%d", port), host)
+}
+
 func (s *StoreSuite) TestRunChecks() {
 	var ch netkat.Checker
 	err := ch.ParseTarget(s.target)
@@ -64,7 +185,18 @@ func (s *StoreSuite) TestRunChecks() {
 	ch.KubernetesComponents = s.client.GetComponents()
 	ch.Client = s.client
 	ch.RunChecks()
-	assert.Equal(s.T(), 3, len(ch.PassedChecks), "Expected checks to pass")
+	// The fixture is the nginx ingress in test/ingress.yaml, without network policies, source ranges or a --from pod.
+	assert.ElementsMatch(s.T(), []string{
+		"CheckKubernetesRouteFromHost",
+		"CheckEndpointsService",
+		"CheckStatusPod",
+		"CheckNetworkPoliciesPod",
+		"CheckSourceRangesIngress",
+		"CheckListeningPod",
+		"CheckStatusNginxIngress",
+		"CheckStatusKubeDns",
+		"CheckListeningHost",
+	}, ch.PassedChecks, "Expected checks to pass")
 }
 
 func (s *StoreSuite) TestCheckKubernetesRouteFromHost() {
@@ -78,6 +210,56 @@ func (s *StoreSuite) TestCheckKubernetesRouteFromHost() {
 	assert.Equal(s.T(), 1, len(ch.PassedChecks), "Expected CheckKubernetesRouteFromHost to pass")
 }
 
+func (s *StoreSuite) TestCheckKubernetesRouteFromPod() {
+	var ch netkat.Checker
+	ch.KubernetesComponents = s.client.GetComponents()
+	err := ch.ParseTarget(fmt.Sprintf("pod/%s.default:8080", ch.KubernetesComponents.PodPorts[0].PodName))
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	ch.CheckKubernetesRouteFromPod()
+	assert.Equal(s.T(), 1, len(ch.PassedChecks), "Expected CheckKubernetesRouteFromPod to pass")
+}
+
+func (s *StoreSuite) TestCheckKubernetesRouteFromPodWithoutIngress() {
+	db := map[string]string{"app": "postgres"}
+	var ch netkat.Checker
+	err := ch.ParseTarget("pod/postgres-0.db:5432")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	ch.KubernetesComponents = &netkat.KubernetesComponents{
+		PodPorts:     []*netkat.PodPort{{PodName: "postgres-0", Namespace: "db", Labels: db, ContainerPort: 5432}},
+		ServicePorts: []*netkat.ServicePort{{ServiceName: "postgres", Namespace: "db", Type: "ClusterIP", Selector: db, SourcePort: 5432, TargetPort: 5432}},
+	}
+	ch.CheckKubernetesRouteFromPod()
+	assert.Equal(s.T(), 1, len(ch.PassedChecks), "Expected a pod behind a service without an ingress to pass")
+	assert.Nil(s.T(), ch.KubernetesRoute.Ingress)
+}
+
+func (s *StoreSuite) TestCheckKubernetesRouteFromService() {
+	var ch netkat.Checker
+	ch.KubernetesComponents = s.client.GetComponents()
+	err := ch.ParseTarget("svc/web.default:8080")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	ch.CheckKubernetesRouteFromService()
+	assert.Equal(s.T(), 1, len(ch.PassedChecks), "Expected CheckKubernetesRouteFromService to pass")
+	assert.NotNil(s.T(), ch.KubernetesRoute.Ingress, "Expected example-ingress upstream of the web service")
+}
+
+func (s *StoreSuite) TestCheckKubernetesRouteFromInternalHost() {
+	var ch netkat.Checker
+	ch.KubernetesComponents = s.client.GetComponents()
+	err := ch.ParseTarget("web.default.svc.cluster.local:8080")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	ch.CheckKubernetesRouteFromInternalHost()
+	assert.Equal(s.T(), 1, len(ch.PassedChecks), "Expected CheckKubernetesRouteFromInternalHost to pass")
+}
+
 func (s *StoreSuite) TestCheckStatusPod() {
 	var ch netkat.Checker
 	err := ch.ParseTarget(s.target)
@@ -91,6 +273,38 @@ func (s *StoreSuite) TestCheckStatusPod() {
 	assert.Equal(s.T(), 1, len(ch.PassedChecks), "Expected CheckStatusPod to pass")
 }
 
+func (s *StoreSuite) TestCheckStatusPodThreshold() {
+	crashing := netkat.PodPort{PodName: "web-b", PodStatus: "Running", Containers: []netkat.ContainerHealth{{Name: "web", WaitingReason: "CrashLoopBackOff"}}}
+	ThresholdTests := []struct {
+		Threshold float64
+		Expected  int
+	}{
+		{75, 1},
+		{100, 0},
+		{0, 0},
+	}
+	for _, test := range ThresholdTests {
+		var ch netkat.Checker
+		ch.PodThreshold = test.Threshold
+		ch.KubernetesRoute = &netkat.KubernetesRoute{Pods: []*netkat.PodPort{&crashing}}
+		for _, podName := range []string{"web-a", "web-c", "web-d"} {
+			ch.KubernetesRoute.Pods = append(ch.KubernetesRoute.Pods, &netkat.PodPort{PodName: podName, PodStatus: "Running", Ready: true})
+		}
+		ch.CheckStatusPod()
+		assert.Equal(s.T(), test.Expected, len(ch.PassedChecks), test.Threshold)
+		assert.Equal(s.T(), 4, len(ch.KubernetesRoute.PodResults), "Expected every pod to be evaluated")
+	}
+
+	var ch netkat.Checker
+	ch.PodThreshold = 75
+	ch.KubernetesRoute = &netkat.KubernetesRoute{Pods: []*netkat.PodPort{&crashing}}
+	for _, port := range []int32{8080, 8443, 9090} {
+		ch.KubernetesRoute.Pods = append(ch.KubernetesRoute.Pods, &netkat.PodPort{PodName: "web-a", ContainerPort: port, PodStatus: "Running", Ready: true})
+	}
+	ch.CheckStatusPod()
+	assert.Empty(s.T(), ch.PassedChecks, "Expected a pod matched on several ports to count once")
+}
+
 func (s *StoreSuite) TestCheckListeningPod() {
 	var ch netkat.Checker
 	ch.KubernetesComponents = s.client.GetComponents()
@@ -2,6 +2,7 @@ package netkat
 
 import (
 	"github.com/go-kit/kit/log/level"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -11,7 +12,8 @@ import (
 type (
 	Client struct {
 		*kubernetes.Clientset
-		Config *rest.Config
+		Config  *rest.Config
+		Dynamic dynamic.Interface
 	}
 )
 
@@ -27,7 +29,12 @@ func InitClient(context string, kubeConfig string) (k8sClient Client) {
 		_ = level.Error(Logger).Log("msg", err)
 		os.Exit(1)
 	}
-	k8sClient = Client{clientSet, config}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		os.Exit(1)
+	}
+	k8sClient = Client{clientSet, config, dynamicClient}
 	return
 }
 
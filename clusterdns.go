@@ -0,0 +1,158 @@
+package netkat
+
+import (
+	"fmt"
+	"k8s.io/api/core/v1"
+	"net"
+	"strings"
+)
+
+type (
+	// ClusterDnsQuery is an in-cluster name and the addresses the cluster DNS should answer with.
+	ClusterDnsQuery struct {
+		Name     string
+		Expected []net.IP
+	}
+)
+
+const (
+	kubeDnsServiceName = "kube-dns"
+	kubeDnsNamespace   = "kube-system"
+	kubeDnsLabel       = "k8s-app"
+	kubeDnsPort        = 53
+)
+
+// FindKubeDnsServicePorts returns the ports of the kube-dns service, the name CoreDNS is also deployed under.
+// Distributions naming it otherwise, such as RKE2's rke2-coredns-rke2-coredns, still label it k8s-app=kube-dns,
+// so the first service with the label is used instead.
+func (co *KubernetesComponents) FindKubeDnsServicePorts() (servicePorts []*ServicePort) {
+	for _, s := range co.ServicePorts {
+		if s.ServiceName == kubeDnsServiceName && s.Namespace == kubeDnsNamespace {
+			servicePorts = append(servicePorts, s)
+		}
+	}
+	if len(servicePorts) > 0 {
+		return
+	}
+	var service *ServicePort
+	for _, s := range co.ServicePorts {
+		if service == nil && s.Labels[kubeDnsLabel] == kubeDnsServiceName {
+			service = s
+		}
+		if service != nil && s.ServiceName == service.ServiceName && s.Namespace == service.Namespace {
+			servicePorts = append(servicePorts, s)
+		}
+	}
+	return
+}
+
+// KubeDnsTcpPort returns the port serving DNS over TCP, the only protocol a port-forward carries.
+func KubeDnsTcpPort(servicePorts []*ServicePort) *ServicePort {
+	for _, s := range servicePorts {
+		if s.Protocol == string(v1.ProtocolTCP) && s.SourcePort == kubeDnsPort {
+			return s
+		}
+	}
+	return nil
+}
+
+// ClusterDnsQueries lists the in-cluster names of the route with the addresses the cluster DNS should answer: the
+// ClusterIP of the service, or the ready endpoints of a headless service. Internal hosts naming a pod should
+// answer with its IP: hostname.subdomain.namespace.svc with the pods on the route, and ip.namespace.pod with the
+// IP it encodes. Without a service the
+// kubernetes service in the default namespace is queried instead, to show the cluster DNS answers at all.
+func (co *KubernetesComponents) ClusterDnsQueries(t *Target, r *KubernetesRoute, clusterDomain string) (queries []*ClusterDnsQuery) {
+	clusterDomain = strings.Trim(clusterDomain, ".")
+	var s *ServicePort
+	if r != nil {
+		s = r.Service
+	}
+	if s == nil {
+		for _, servicePort := range co.ServicePorts {
+			if servicePort.ServiceName == "kubernetes" && servicePort.Namespace == "default" {
+				s = servicePort
+				break
+			}
+		}
+	}
+	if s == nil {
+		return
+	}
+	name := fmt.Sprintf("%s.%s.svc.%s", s.ServiceName, s.Namespace, clusterDomain)
+	query := &ClusterDnsQuery{Name: name}
+	if s.Headless {
+		for _, e := range s.ReadyEndpoints() {
+			query.Expected = appendUniqueIp(query.Expected, e.IpAddress)
+		}
+	} else if s.ClusterIP != nil {
+		query.Expected = []net.IP{s.ClusterIP}
+	}
+	queries = append(queries, query)
+	if t == nil || t.Kind != InternalHostTarget || (t.Hostname == "" && t.IpAddress == nil) {
+		return
+	}
+	// The queries are absolute, so short internal hosts are qualified with the cluster domain.
+	host := strings.TrimSuffix(strings.TrimSuffix(t.Host, "."), "."+clusterDomain) + "." + clusterDomain
+	podQuery := &ClusterDnsQuery{Name: host}
+	if t.IpAddress != nil {
+		podQuery.Expected = []net.IP{t.IpAddress}
+	} else if r != nil {
+		for _, p := range r.Pods {
+			podQuery.Expected = appendUniqueIp(podQuery.Expected, p.PodIP)
+		}
+	}
+	queries = append(queries, podQuery)
+	return
+}
+
+func appendUniqueIp(ipAddresses []net.IP, ip net.IP) []net.IP {
+	if ip == nil || containsIp(ipAddresses, ip) {
+		return ipAddresses
+	}
+	return append(ipAddresses, ip)
+}
+
+// Compare returns the expected addresses missing from the answers, and the answered addresses that weren't
+// expected. Only the address families expected are compared, so dual-stack answers aren't reported.
+func (q *ClusterDnsQuery) Compare(answers []net.IP) (missing []net.IP, unexpected []net.IP) {
+	families := make(map[bool]bool)
+	for _, ip := range q.Expected {
+		families[ip.To4() != nil] = true
+		if !containsIp(answers, ip) {
+			missing = append(missing, ip)
+		}
+	}
+	for _, ip := range answers {
+		if families[ip.To4() != nil] && !containsIp(q.Expected, ip) {
+			unexpected = append(unexpected, ip)
+		}
+	}
+	return
+}
+
+func containsIp(ipAddresses []net.IP, ip net.IP) bool {
+	for _, address := range ipAddresses {
+		if address.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveThroughPod queries the DNS server of the pod over a port-forward, using TCP.
+func (c *Client) ResolveThroughPod(p *PodPort, name string) (answers []net.IP, err error) {
+	forward, err := c.ForwardPort(p, portForwardTimeout)
+	if err != nil {
+		return
+	}
+	defer forward.Close()
+	resolver := Resolver{Nameservers: []string{forward.LocalAddress}, Net: "tcp"}
+	records, _, err := resolver.Resolve(name)
+	if err != nil {
+		return
+	}
+	for _, r := range records {
+		answers = append(answers, r.IpAddress)
+	}
+	return
+}
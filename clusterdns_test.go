@@ -0,0 +1,114 @@
+package netkat_test
+
+import (
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+	"net"
+)
+
+type (
+	ClusterDnsQueriesTest struct {
+		Target   netkat.Target
+		Route    *netkat.KubernetesRoute
+		Names    []string
+		Expected [][]string
+	}
+
+	ClusterDnsCompareTest struct {
+		Expected   []string
+		Answers    []string
+		Missing    int
+		Unexpected int
+	}
+)
+
+var (
+	kubernetesService = netkat.ServicePort{ServiceName: "kubernetes", Namespace: "default", ClusterIP: net.ParseIP("10.96.0.1")}
+	webService        = netkat.ServicePort{ServiceName: "web", Namespace: "shop", ClusterIP: net.ParseIP("10.96.4.20")}
+	headlessService   = netkat.ServicePort{ServiceName: "db", Namespace: "shop", Headless: true, Endpoints: []*netkat.ServiceEndpoint{
+		{IpAddress: net.ParseIP("10.244.1.5"), Ready: true},
+		{IpAddress: net.ParseIP("10.244.2.7"), Ready: true},
+		{IpAddress: net.ParseIP("10.244.3.9"), Ready: false},
+	}}
+	dbPod = netkat.PodPort{PodName: "db-0", PodIP: net.ParseIP("10.244.1.5")}
+
+	ClusterDnsQueriesTests = []ClusterDnsQueriesTest{
+		{netkat.Target{Kind: netkat.ServiceTarget}, &netkat.KubernetesRoute{Service: &webService},
+			[]string{"web.shop.svc.cluster.local"}, [][]string{{"10.96.4.20"}}},
+		{netkat.Target{Kind: netkat.ServiceTarget}, &netkat.KubernetesRoute{Service: &headlessService},
+			[]string{"db.shop.svc.cluster.local"}, [][]string{{"10.244.1.5", "10.244.2.7"}}},
+		{netkat.Target{Kind: netkat.HostTarget}, &netkat.KubernetesRoute{},
+			[]string{"kubernetes.default.svc.cluster.local"}, [][]string{{"10.96.0.1"}}},
+		{netkat.Target{Kind: netkat.InternalHostTarget, Host: "db-0.db.shop.svc.cluster.local", Hostname: "db-0"}, &netkat.KubernetesRoute{Service: &headlessService, Pods: []*netkat.PodPort{&dbPod}},
+			[]string{"db.shop.svc.cluster.local", "db-0.db.shop.svc.cluster.local"}, [][]string{{"10.244.1.5", "10.244.2.7"}, {"10.244.1.5"}}},
+		{netkat.Target{Kind: netkat.InternalHostTarget, Host: "db-0.db.shop.svc", Hostname: "db-0"}, &netkat.KubernetesRoute{Service: &headlessService, Pods: []*netkat.PodPort{&dbPod}},
+			[]string{"db.shop.svc.cluster.local", "db-0.db.shop.svc.cluster.local"}, [][]string{{"10.244.1.5", "10.244.2.7"}, {"10.244.1.5"}}},
+		{netkat.Target{Kind: netkat.InternalHostTarget, Host: "web.shop.svc"}, &netkat.KubernetesRoute{Service: &webService},
+			[]string{"web.shop.svc.cluster.local"}, [][]string{{"10.96.4.20"}}},
+		{netkat.Target{Kind: netkat.InternalHostTarget, Host: "10-244-1-5.shop.pod", IpAddress: net.ParseIP("10.244.1.5")}, &netkat.KubernetesRoute{Pods: []*netkat.PodPort{&dbPod}},
+			[]string{"kubernetes.default.svc.cluster.local", "10-244-1-5.shop.pod.cluster.local"}, [][]string{{"10.96.0.1"}, {"10.244.1.5"}}},
+	}
+
+	ClusterDnsCompareTests = []ClusterDnsCompareTest{
+		{[]string{"10.96.4.20"}, []string{"10.96.4.20"}, 0, 0},
+		{[]string{"10.96.4.20"}, []string{"10.96.4.20", "fd00::4:20"}, 0, 0},
+		{[]string{"10.96.4.20"}, []string{"10.96.4.21"}, 1, 1},
+		{[]string{"10.244.1.5", "10.244.2.7"}, []string{"10.244.1.5"}, 1, 0},
+	}
+)
+
+func (s *StoreSuite) TestClusterDnsQueries() {
+	components := netkat.KubernetesComponents{ServicePorts: []*netkat.ServicePort{&kubernetesService, &webService, &headlessService}}
+	for _, test := range ClusterDnsQueriesTests {
+		target := test.Target
+		queries := components.ClusterDnsQueries(&target, test.Route, netkat.DefaultClusterDomain)
+		var names []string
+		var expected [][]string
+		for _, q := range queries {
+			names = append(names, q.Name)
+			var addresses []string
+			for _, ip := range q.Expected {
+				addresses = append(addresses, ip.String())
+			}
+			expected = append(expected, addresses)
+		}
+		assert.Equal(s.T(), test.Names, names)
+		assert.Equal(s.T(), test.Expected, expected)
+	}
+}
+
+func (s *StoreSuite) TestClusterDnsCompare() {
+	for _, test := range ClusterDnsCompareTests {
+		q := netkat.ClusterDnsQuery{Name: "web.shop.svc.cluster.local"}
+		for _, ip := range test.Expected {
+			q.Expected = append(q.Expected, net.ParseIP(ip))
+		}
+		var answers []net.IP
+		for _, ip := range test.Answers {
+			answers = append(answers, net.ParseIP(ip))
+		}
+		missing, unexpected := q.Compare(answers)
+		assert.Equal(s.T(), test.Missing, len(missing), test.Answers)
+		assert.Equal(s.T(), test.Unexpected, len(unexpected), test.Answers)
+	}
+}
+
+func (s *StoreSuite) TestKubeDnsTcpPort() {
+	udp := netkat.ServicePort{ServiceName: "kube-dns", Namespace: "kube-system", SourcePortName: "dns", Protocol: "UDP", SourcePort: 53}
+	tcp := netkat.ServicePort{ServiceName: "kube-dns", Namespace: "kube-system", SourcePortName: "dns-tcp", Protocol: "TCP", SourcePort: 53}
+	metrics := netkat.ServicePort{ServiceName: "kube-dns", Namespace: "kube-system", SourcePortName: "metrics", Protocol: "TCP", SourcePort: 9153}
+	components := netkat.KubernetesComponents{ServicePorts: []*netkat.ServicePort{&webService, &udp, &tcp, &metrics}}
+	servicePorts := components.FindKubeDnsServicePorts()
+	assert.Equal(s.T(), 3, len(servicePorts))
+	assert.Equal(s.T(), &tcp, netkat.KubeDnsTcpPort(servicePorts))
+}
+
+func (s *StoreSuite) TestFindKubeDnsServicePortsByLabel() {
+	labels := map[string]string{"k8s-app": "kube-dns"}
+	udp := netkat.ServicePort{ServiceName: "rke2-coredns-rke2-coredns", Namespace: "kube-system", Labels: labels, SourcePortName: "udp-53", Protocol: "UDP", SourcePort: 53}
+	tcp := netkat.ServicePort{ServiceName: "rke2-coredns-rke2-coredns", Namespace: "kube-system", Labels: labels, SourcePortName: "tcp-53", Protocol: "TCP", SourcePort: 53}
+	components := netkat.KubernetesComponents{ServicePorts: []*netkat.ServicePort{&webService, &udp, &tcp}}
+	assert.Equal(s.T(), []*netkat.ServicePort{&udp, &tcp}, components.FindKubeDnsServicePorts())
+	components = netkat.KubernetesComponents{ServicePorts: []*netkat.ServicePort{&webService}}
+	assert.Empty(s.T(), components.FindKubeDnsServicePorts())
+}
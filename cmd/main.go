@@ -7,17 +7,31 @@ import (
 	"github.com/go-kit/kit/log/level"
 	"github.com/spf13/cobra"
 	"github.com/stevenayers/netkat"
+	"net"
 	"os"
 	"os/user"
 )
 
 var (
-	config  string
-	context string
+	config        string
+	context       string
+	clusterDomain string
+	resolve       []string
+	nameservers   []string
+	dnsProtocol   string
+	podThreshold  float64
+	probe         string
+	probeSend     string
+	probeExpect   string
+	from          string
+	debugImage    string
+	attachDebug   bool
+	originIp      string
+	originIpUrl   string
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "netkat [TARGET URL]",
+	Use:   "netkat [TARGET URL | pod/NAME[.NAMESPACE]:PORT | svc/NAME[.NAMESPACE]:PORT]",
 	Short: "Netkat is a CLI for troubleshooting kubernetes networking issues",
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
@@ -28,6 +42,46 @@ var rootCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		netkat.InitLogger(log.NewSyncWriter(os.Stdout), "error")
 		var ch netkat.Checker
+		ch.ClusterDomain = clusterDomain
+		if podThreshold <= 0 || podThreshold > 100 {
+			_ = level.Error(netkat.Logger).Log("msg", fmt.Sprintf("invalid --pod-threshold '%v', expected a percentage above 0 and up to 100", podThreshold))
+			os.Exit(1)
+		}
+		ch.PodThreshold = podThreshold
+		if probe != "" || probeSend != "" || probeExpect != "" {
+			ch.Probe = &netkat.PortProbe{Send: probeSend, Expect: probeExpect}
+			protocol, ok := netkat.ProbeProtocolFor(probe)
+			switch {
+			case probe == "":
+				ch.Probe.Protocol = netkat.ProbeRaw
+			case !ok:
+				_ = level.Error(netkat.Logger).Log("msg", fmt.Sprintf("invalid --probe '%s', expected tcp, http, https, h2c, grpc or raw", probe))
+				os.Exit(1)
+			default:
+				ch.Probe.Protocol = protocol
+			}
+		}
+		if dnsProtocol != "udp" && dnsProtocol != "tcp" {
+			_ = level.Error(netkat.Logger).Log("msg", fmt.Sprintf("invalid --dns-protocol '%s', expected udp or tcp", dnsProtocol))
+			os.Exit(1)
+		}
+		ch.Resolver = &netkat.Resolver{Net: dnsProtocol}
+		for _, nameserver := range nameservers {
+			normalized, err := netkat.NormalizeNameserver(nameserver)
+			if err != nil {
+				_ = level.Error(netkat.Logger).Log("msg", err)
+				os.Exit(1)
+			}
+			ch.Resolver.Nameservers = append(ch.Resolver.Nameservers, normalized)
+		}
+		for _, value := range resolve {
+			override, err := netkat.ParseResolveOverride(value)
+			if err != nil {
+				_ = level.Error(netkat.Logger).Log("msg", err)
+				os.Exit(1)
+			}
+			ch.ResolveOverrides = append(ch.ResolveOverrides, override)
+		}
 		if config == "" {
 			usr, _ := user.Current()
 			config = fmt.Sprintf("%v/.kube/config", usr.HomeDir)
@@ -35,9 +89,28 @@ var rootCmd = &cobra.Command{
 		ch.Client = netkat.InitClient(context, config)
 		ch.KubernetesComponents = ch.Client.GetComponents()
 
+		if from != "" {
+			err := ch.ParseSource(from)
+			if err != nil {
+				_ = level.Error(netkat.Logger).Log("msg", err)
+				os.Exit(1)
+			}
+		}
+		ch.DebugImage = debugImage
+		ch.DebugContainer = attachDebug
+		if originIp != "" {
+			ch.Origin = net.ParseIP(originIp)
+			if ch.Origin == nil {
+				_ = level.Error(netkat.Logger).Log("msg", fmt.Sprintf("invalid --origin-ip '%s', expected an ip address", originIp))
+				os.Exit(1)
+			}
+		}
+		ch.OriginIpUrl = originIpUrl
+
 		err := ch.ParseTarget(args[0])
 		if err != nil {
 			_ = level.Error(netkat.Logger).Log("msg", err)
+			os.Exit(1)
 		}
 		ch.RunChecks()
 	},
@@ -53,6 +126,19 @@ func Execute() {
 func init() {
 	rootCmd.PersistentFlags().StringVar(&config, "config", "", "Kubernetes config file (default is $HOME/.kube/config)")
 	rootCmd.PersistentFlags().StringVar(&context, "context", "default", "Kubernetes cluster context name")
+	rootCmd.PersistentFlags().StringArrayVar(&resolve, "resolve", nil, "Resolve host:port to the given address instead of using DNS, as host:port:address[,address]")
+	rootCmd.PersistentFlags().StringArrayVar(&nameservers, "nameserver", nil, "Nameserver used to resolve the target instead of the system resolver, repeat to compare several")
+	rootCmd.PersistentFlags().StringVar(&dnsProtocol, "dns-protocol", "udp", "Protocol used to query nameservers, udp or tcp")
+	rootCmd.PersistentFlags().Float64Var(&podThreshold, "pod-threshold", netkat.DefaultPodThreshold, "Percentage of pods on the route that must be healthy and listening for the pod checks to pass")
+	rootCmd.PersistentFlags().StringVar(&probe, "probe", "", "Protocol used to check pods and hosts are listening, tcp, http, https, h2c, grpc or raw (default picked from the scheme, appProtocol and port name)")
+	rootCmd.PersistentFlags().StringVar(&probeSend, "probe-send", "", "Payload sent by raw probes")
+	rootCmd.PersistentFlags().StringVar(&probeExpect, "probe-expect", "", "Text raw probes expect in the reply")
+	rootCmd.PersistentFlags().StringVar(&from, "from", "", "Source to check the target from, a pod as pod/name[.namespace], a namespace as namespace/name, or an external address or cidr")
+	rootCmd.PersistentFlags().StringVar(&debugImage, "debug-image", netkat.DefaultDebugImage, "Image of the ephemeral container attached to the --from pod with --debug-container")
+	rootCmd.PersistentFlags().BoolVar(&attachDebug, "debug-container", false, "Attach an ephemeral debug container to the --from pod when it has no shell or network tools, it can't be removed afterwards")
+	rootCmd.PersistentFlags().StringVar(&originIp, "origin-ip", "", "Address traffic to the target originates from, checked against source ranges (default discovered from --origin-ip-url)")
+	rootCmd.PersistentFlags().StringVar(&originIpUrl, "origin-ip-url", netkat.DefaultOriginIpUrl, "Endpoint answering with the caller's public ip as plain text, used when --origin-ip is not set")
+	rootCmd.PersistentFlags().StringVar(&clusterDomain, "cluster-domain", netkat.DefaultClusterDomain, "Kubernetes cluster DNS domain used to recognise in-cluster hosts")
 }
 
 func main() {
@@ -0,0 +1,228 @@
+package netkat
+
+import (
+	"fmt"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type (
+	// ControllerWorkload is the Deployment or DaemonSet running ingress controller pods.
+	ControllerWorkload struct {
+		Kind      string
+		Name      string
+		Namespace string
+		Desired   int32
+		Ready     int32
+	}
+)
+
+const (
+	defaultNginxIngressClass    = "nginx"
+	defaultNginxControllerClass = "k8s.io/ingress-nginx"
+	defaultNginxHealthzPort     = 10254
+	nginxHealthzPath            = "/healthz"
+)
+
+// FindIngressNginxPods finds the ingress-nginx controller pods serving the ingress path. Classes with an
+// IngressClass are matched by its controller against the --controller-class flag, and classes only named by the
+// legacy annotation against the --ingress-class flag. Ingresses without a class are served by the controller of
+// the default IngressClass, and by controllers started with --watch-ingress-without-class.
+func (co *KubernetesComponents) FindIngressNginxPods(i *IngressPath) (pods []*PodPort) {
+	for _, p := range uniquePods(co.FindIngressControllerPodPorts(IngressControllerNginx)) {
+		if nginxServes(p, i) {
+			pods = append(pods, p)
+		}
+	}
+	return
+}
+
+// FindIngressPathControllerPodPorts returns the ports of the controller pods serving the ingress path. Traefik
+// pods serve every path named for Traefik, and the rest are matched against the ingress-nginx pods by class.
+func (co *KubernetesComponents) FindIngressPathControllerPodPorts(i *IngressPath) (podPorts []*PodPort) {
+	if IngressControllerFor(i) == IngressControllerTraefik {
+		return co.FindIngressControllerPodPorts(IngressControllerTraefik)
+	}
+	for _, p := range co.FindIngressControllerPodPorts(IngressControllerNginx) {
+		if nginxServes(p, i) {
+			podPorts = append(podPorts, p)
+		}
+	}
+	return
+}
+
+// nginxServes reports whether the ingress-nginx pod serves the ingress path's class.
+func nginxServes(p *PodPort, i *IngressPath) bool {
+	controllerClass := argValue(p.Args, "--controller-class")
+	if controllerClass == "" {
+		controllerClass = defaultNginxControllerClass
+	}
+	ingressClass := argValue(p.Args, "--ingress-class")
+	if ingressClass == "" {
+		ingressClass = defaultNginxIngressClass
+	}
+	switch {
+	case i.IngressClassName == "" && argEnabled(p.Args, "--watch-ingress-without-class"):
+		return true
+	case i.IngressClassController != "":
+		return i.IngressClassController == controllerClass
+	default:
+		return i.IngressClassName != "" && i.IngressClassName == ingressClass
+	}
+}
+
+// NginxHealthzPort returns the port the controller serves /healthz on, set by its --healthz-port flag.
+func NginxHealthzPort(p *PodPort) int32 {
+	port, err := strconv.Atoi(argValue(p.Args, "--healthz-port"))
+	if err != nil {
+		return defaultNginxHealthzPort
+	}
+	return int32(port)
+}
+
+// argValue returns the value of a flag given as --flag=value or --flag value. Flags are matched case
+// insensitively, as Traefik's are, and with one or two leading dashes.
+func argValue(args []string, flag string) string {
+	for n, arg := range args {
+		name, value, hasValue := splitArg(arg)
+		if !strings.EqualFold(name, strings.TrimLeft(flag, "-")) {
+			continue
+		}
+		if !hasValue && n+1 < len(args) && !strings.HasPrefix(args[n+1], "-") {
+			value = args[n+1]
+		}
+		return value
+	}
+	return ""
+}
+
+// argEnabled reports whether a boolean flag is set, given as --flag or --flag=true. Boolean flags never take
+// their value from the next argument.
+func argEnabled(args []string, flag string) bool {
+	for _, arg := range args {
+		name, value, hasValue := splitArg(arg)
+		if strings.EqualFold(name, strings.TrimLeft(flag, "-")) {
+			return !hasValue || value == "true"
+		}
+	}
+	return false
+}
+
+// splitArg splits a --flag=value argument into the flag name without dashes and the value.
+func splitArg(arg string) (name string, value string, hasValue bool) {
+	if !strings.HasPrefix(arg, "-") {
+		return
+	}
+	parts := strings.SplitN(strings.TrimLeft(arg, "-"), "=", 2)
+	name = parts[0]
+	if len(parts) == 2 {
+		value, hasValue = parts[1], true
+	}
+	return
+}
+
+// FindControllerWorkloads finds the Deployments and DaemonSets whose selectors match the controller pods.
+func (c *Client) FindControllerWorkloads(pods []*PodPort) (workloads []*ControllerWorkload, err error) {
+	namespaces := make(map[string]bool)
+	for _, p := range pods {
+		namespaces[p.Namespace] = true
+	}
+	for namespace := range namespaces {
+		deployments, listErr := c.AppsV1().Deployments(namespace).List(metav1.ListOptions{})
+		if listErr != nil {
+			err = listErr
+			return
+		}
+		for _, d := range deployments.Items {
+			if selectsAnyPod(d.Spec.Selector, pods) {
+				desired := int32(1)
+				if d.Spec.Replicas != nil {
+					desired = *d.Spec.Replicas
+				}
+				workloads = append(workloads, &ControllerWorkload{"Deployment", d.Name, d.Namespace, desired, d.Status.ReadyReplicas})
+			}
+		}
+		daemonSets, listErr := c.AppsV1().DaemonSets(namespace).List(metav1.ListOptions{})
+		if listErr != nil {
+			err = listErr
+			return
+		}
+		for _, d := range daemonSets.Items {
+			if selectsAnyPod(d.Spec.Selector, pods) {
+				workloads = append(workloads, &ControllerWorkload{"DaemonSet", d.Name, d.Namespace, d.Status.DesiredNumberScheduled, d.Status.NumberReady})
+			}
+		}
+	}
+	return
+}
+
+func selectsAnyPod(selector *metav1.LabelSelector, pods []*PodPort) bool {
+	for _, p := range pods {
+		if selector != nil && selectorMatches(selector, p.Labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetHealthz requests the health endpoint of the pod over a port-forward, healthy when it answers 200 OK.
+func (c *Client) GetHealthz(p *PodPort, port int32, path string) (result string, healthy bool) {
+	response, _, err := c.getThroughForward(p, port, path)
+	if err != nil {
+		result = err.Error()
+		return
+	}
+	result = response.Status
+	healthy = response.StatusCode == http.StatusOK
+	return
+}
+
+// getThroughForward requests the path from a port of the pod over a port-forward, returning the response with
+// its body read.
+func (c *Client) getThroughForward(p *PodPort, port int32, path string) (response *http.Response, body []byte, err error) {
+	forwardPort := *p
+	forwardPort.ContainerPort = port
+	forward, err := c.ForwardPort(&forwardPort, portForwardTimeout)
+	if err != nil {
+		return
+	}
+	defer forward.Close()
+	client := http.Client{Timeout: probeTimeout}
+	response, err = client.Get(fmt.Sprintf("http://%s%s", forward.LocalAddress, path))
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	body, err = ioutil.ReadAll(response.Body)
+	return
+}
+
+// LoadBalancerMatchesIngress checks the controller service's external address is one the ingress status
+// publishes, which is what DNS for the ingress hosts should point at.
+func LoadBalancerMatchesIngress(lb *ServicePort, i *IngressPath) (matches bool, reason string) {
+	switch {
+	case lb.ExternalIP != nil && i.HasAddress(lb.ExternalIP):
+		return true, fmt.Sprintf("ingress status publishes %s", lb.ExternalIP)
+	case lb.ExternalIP == nil && lb.ExternalHostname != "":
+		for _, hostname := range i.LoadBalancerHostnames {
+			if hostname == lb.ExternalHostname {
+				return true, fmt.Sprintf("ingress status publishes %s", hostname)
+			}
+		}
+	case lb.ExternalIP == nil:
+		return false, fmt.Sprintf("service %s.%s has no external address yet", lb.ServiceName, lb.Namespace)
+	}
+	published := append([]string{}, i.LoadBalancerHostnames...)
+	for _, ip := range i.IpAddresses {
+		published = append(published, ip.String())
+	}
+	external := lb.ExternalHostname
+	if lb.ExternalIP != nil {
+		external = lb.ExternalIP.String()
+	}
+	return false, fmt.Sprintf("service %s.%s is exposed on %s but the ingress status publishes '%s'",
+		lb.ServiceName, lb.Namespace, external, strings.Join(published, ", "))
+}
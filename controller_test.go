@@ -0,0 +1,79 @@
+package netkat_test
+
+import (
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+)
+
+type (
+	IngressNginxPodsTest struct {
+		IngressClassName string
+		DefaultClass     bool
+		Expected         []string
+	}
+
+	LoadBalancerMatchTest struct {
+		LoadBalancer netkat.ServicePort
+		Ingress      netkat.IngressPath
+		Expected     bool
+	}
+)
+
+var (
+	nginxLabels = map[string]string{"app.kubernetes.io/name": "ingress-nginx"}
+
+	IngressNginxPodsTests = []IngressNginxPodsTest{
+		{"", true, []string{"public-0", "internal-0"}},
+		{"", false, []string{"internal-0"}},
+		{"nginx", true, []string{"public-0"}},
+		{"internal", true, []string{"internal-0"}},
+		{"nginx-internal", true, []string{"internal-0"}},
+		{"traefik", true, nil},
+	}
+
+	LoadBalancerMatchTests = []LoadBalancerMatchTest{
+		{netkat.ServicePort{ExternalIP: net.ParseIP("34.89.100.2")}, netkat.IngressPath{IpAddresses: []net.IP{net.ParseIP("34.89.100.2")}}, true},
+		{netkat.ServicePort{ExternalIP: net.ParseIP("34.89.100.3")}, netkat.IngressPath{IpAddresses: []net.IP{net.ParseIP("34.89.100.2")}}, false},
+		{netkat.ServicePort{ExternalHostname: "a1.elb.amazonaws.com"}, netkat.IngressPath{LoadBalancerHostnames: []string{"a1.elb.amazonaws.com"}}, true},
+		{netkat.ServicePort{ExternalHostname: "a2.elb.amazonaws.com"}, netkat.IngressPath{LoadBalancerHostnames: []string{"a1.elb.amazonaws.com"}}, false},
+		{netkat.ServicePort{}, netkat.IngressPath{IpAddresses: []net.IP{net.ParseIP("34.89.100.2")}}, false},
+	}
+)
+
+func (s *StoreSuite) TestFindIngressNginxPods() {
+	components := netkat.KubernetesComponents{PodPorts: []*netkat.PodPort{
+		{PodName: "public-0", Labels: nginxLabels, ContainerPort: 80, Args: []string{"/nginx-ingress-controller"}},
+		{PodName: "public-0", Labels: nginxLabels, ContainerPort: 443, Args: []string{"/nginx-ingress-controller"}},
+		{PodName: "internal-0", Labels: nginxLabels, ContainerPort: 80, Args: []string{"/nginx-ingress-controller", "--ingress-class", "nginx-internal",
+			"--controller-class=k8s.io/ingress-nginx-internal", "--watch-ingress-without-class", "--healthz-port=11254"}},
+		{PodName: "web-0", Labels: map[string]string{"app": "web"}, ContainerPort: 80},
+	}}
+	for _, test := range IngressNginxPodsTests {
+		classes := netkat.IngressClassList{Items: []netkat.IngressClass{
+			{ObjectMeta: metav1.ObjectMeta{Name: "nginx"}, Spec: netkat.IngressClassSpec{Controller: "k8s.io/ingress-nginx"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "internal"}, Spec: netkat.IngressClassSpec{Controller: "k8s.io/ingress-nginx-internal"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "traefik"}, Spec: netkat.IngressClassSpec{Controller: "traefik.io/ingress-controller"}},
+		}}
+		if test.DefaultClass {
+			classes.Items[0].Annotations = map[string]string{"ingressclass.kubernetes.io/is-default-class": "true"}
+		}
+		ingressPath := netkat.IngressPath{IngressClassName: test.IngressClassName}
+		netkat.AttachIngressClassControllers([]*netkat.IngressPath{&ingressPath}, &classes)
+		var podNames []string
+		for _, p := range components.FindIngressNginxPods(&ingressPath) {
+			podNames = append(podNames, p.PodName)
+		}
+		assert.Equal(s.T(), test.Expected, podNames, test.IngressClassName)
+	}
+	assert.Equal(s.T(), int32(10254), netkat.NginxHealthzPort(components.PodPorts[0]))
+	assert.Equal(s.T(), int32(11254), netkat.NginxHealthzPort(components.PodPorts[2]))
+}
+
+func (s *StoreSuite) TestLoadBalancerMatchesIngress() {
+	for _, test := range LoadBalancerMatchTests {
+		matches, reason := netkat.LoadBalancerMatchesIngress(&test.LoadBalancer, &test.Ingress)
+		assert.Equal(s.T(), test.Expected, matches, reason)
+	}
+}
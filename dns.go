@@ -0,0 +1,217 @@
+package netkat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miekg/dns"
+	"net"
+	"strings"
+	"time"
+)
+
+type (
+	DnsRecord struct {
+		Name      string
+		Type      string
+		IpAddress net.IP
+		// Ttl is zero when the answer came from a source without TTLs, such as /etc/hosts.
+		Ttl uint32
+	}
+
+	Resolver struct {
+		Nameservers []string
+		// Net is the transport used for queries, "udp" (the default) or "tcp".
+		Net     string
+		Timeout time.Duration
+	}
+)
+
+const (
+	resolvConf     = "/etc/resolv.conf"
+	maxCnameChain  = 8
+	defaultTimeout = 5 * time.Second
+)
+
+// NormalizeNameserver adds the default DNS port to nameservers given without one.
+func NormalizeNameserver(nameserver string) (normalized string, err error) {
+	if _, _, splitErr := net.SplitHostPort(nameserver); splitErr == nil {
+		normalized = nameserver
+		return
+	}
+	if net.ParseIP(strings.Trim(nameserver, "[]")) == nil {
+		err = fmt.Errorf("invalid nameserver '%s', expected an ip address with an optional port", nameserver)
+		return
+	}
+	normalized = net.JoinHostPort(strings.Trim(nameserver, "[]"), "53")
+	return
+}
+
+func (r *Resolver) Name() string {
+	if len(r.Nameservers) == 0 {
+		return "system resolver"
+	}
+	return fmt.Sprintf("%s (%s)", strings.Join(r.Nameservers, ", "), r.transport())
+}
+
+func (r *Resolver) transport() string {
+	if r.Net == "" {
+		return "udp"
+	}
+	return r.Net
+}
+
+// Resolve looks up every A and AAAA record for the host, following the CNAME chain, from the configured
+// nameservers or by default from those in /etc/resolv.conf. A failed A or AAAA query is only reported when
+// neither gave an answer. Without configured nameservers the system resolver is also asked, and its answer is
+// used when DNS gave none or it has addresses DNS doesn't, as they come from /etc/hosts or another source.
+func (r *Resolver) Resolve(host string) (records []*DnsRecord, cnameChain []string, err error) {
+	if len(r.Nameservers) > 0 {
+		return r.resolve(r.Nameservers, host)
+	}
+	nameservers, err := systemNameservers()
+	if err == nil {
+		records, cnameChain, err = r.resolve(nameservers, host)
+	}
+	systemRecords, systemChain, systemErr := r.lookupSystem(host)
+	if systemErr != nil {
+		if err == nil && len(records) == 0 {
+			err = systemErr
+		}
+		return
+	}
+	if err != nil || !hasAddresses(records, systemRecords) {
+		return systemRecords, systemChain, nil
+	}
+	return
+}
+
+func (r *Resolver) resolve(nameservers []string, host string) (records []*DnsRecord, cnameChain []string, err error) {
+	for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+		qtypeRecords, qtypeChain, qtypeErr := r.query(nameservers, host, qtype)
+		if qtypeErr != nil {
+			err = qtypeErr
+			continue
+		}
+		records = append(records, qtypeRecords...)
+		if len(qtypeChain) > len(cnameChain) {
+			cnameChain = qtypeChain
+		}
+	}
+	if len(records) > 0 {
+		err = nil
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("no A or AAAA records found for %s", host)
+	}
+	return
+}
+
+// systemNameservers reads the nameservers the system resolver queries from /etc/resolv.conf.
+func systemNameservers() (nameservers []string, err error) {
+	config, err := dns.ClientConfigFromFile(resolvConf)
+	if err != nil {
+		return
+	}
+	for _, server := range config.Servers {
+		nameservers = append(nameservers, net.JoinHostPort(server, config.Port))
+	}
+	if len(nameservers) == 0 {
+		err = fmt.Errorf("no nameservers found in %s", resolvConf)
+	}
+	return
+}
+
+// hasAddresses reports whether the records hold every address of the other records.
+func hasAddresses(records []*DnsRecord, others []*DnsRecord) bool {
+	var ipAddresses []net.IP
+	for _, r := range records {
+		ipAddresses = append(ipAddresses, r.IpAddress)
+	}
+	for _, r := range others {
+		if !containsIp(ipAddresses, r.IpAddress) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Resolver) query(nameservers []string, host string, qtype uint16) (records []*DnsRecord, cnameChain []string, err error) {
+	name := dns.Fqdn(host)
+	for hop := 0; hop < maxCnameChain; hop++ {
+		var response *dns.Msg
+		response, err = r.exchange(nameservers, name, qtype)
+		if err != nil {
+			return
+		}
+		if response.Rcode != dns.RcodeSuccess {
+			err = fmt.Errorf("%s lookup for %s returned %s", dns.TypeToString[qtype], name, dns.RcodeToString[response.Rcode])
+			return
+		}
+		next := ""
+		for _, answer := range response.Answer {
+			switch rr := answer.(type) {
+			case *dns.CNAME:
+				cnameChain = append(cnameChain, rr.Target)
+				next = rr.Target
+			case *dns.A:
+				records = append(records, &DnsRecord{Name: rr.Hdr.Name, Type: "A", IpAddress: rr.A, Ttl: rr.Hdr.Ttl})
+			case *dns.AAAA:
+				records = append(records, &DnsRecord{Name: rr.Hdr.Name, Type: "AAAA", IpAddress: rr.AAAA, Ttl: rr.Hdr.Ttl})
+			}
+		}
+		// Recursive resolvers normally return the whole chain, only chase a CNAME they left unresolved.
+		if len(records) > 0 || next == "" {
+			return
+		}
+		name = next
+	}
+	err = fmt.Errorf("cname chain for %s is longer than %d records", host, maxCnameChain)
+	return
+}
+
+func (r *Resolver) exchange(nameservers []string, name string, qtype uint16) (response *dns.Msg, err error) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	msg := new(dns.Msg)
+	msg.SetQuestion(name, qtype)
+	client := dns.Client{Net: r.Net, Timeout: timeout}
+	for _, nameserver := range nameservers {
+		response, _, err = client.Exchange(msg, nameserver)
+		if err == nil && response.Truncated && r.Net != "tcp" {
+			tcpClient := dns.Client{Net: "tcp", Timeout: timeout}
+			response, _, err = tcpClient.Exchange(msg, nameserver)
+		}
+		if err == nil {
+			return
+		}
+	}
+	if err == nil {
+		err = errors.New("no nameservers configured")
+	}
+	return
+}
+
+// lookupSystem only sees the canonical name at the end of a CNAME chain, not the records in between, and no TTLs.
+func (r *Resolver) lookupSystem(host string) (records []*DnsRecord, cnameChain []string, err error) {
+	addresses, err := net.DefaultResolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return
+	}
+	name := dns.Fqdn(host)
+	if cname, cnameErr := net.DefaultResolver.LookupCNAME(context.Background(), host); cnameErr == nil && !strings.EqualFold(dns.Fqdn(cname), name) {
+		cnameChain = []string{dns.Fqdn(cname)}
+		name = dns.Fqdn(cname)
+	}
+	for _, address := range addresses {
+		recordType := "A"
+		if address.IP.To4() == nil {
+			recordType = "AAAA"
+		}
+		records = append(records, &DnsRecord{Name: name, Type: recordType, IpAddress: address.IP})
+	}
+	return
+}
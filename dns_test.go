@@ -0,0 +1,82 @@
+package netkat_test
+
+import (
+	"github.com/miekg/dns"
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+	"net"
+)
+
+type (
+	NameserverTest struct {
+		Nameserver string
+		Expected   string
+	}
+)
+
+var (
+	NameserverTests = []NameserverTest{
+		{"8.8.8.8", "8.8.8.8:53"},
+		{"8.8.8.8:5353", "8.8.8.8:5353"},
+		{"2001:4860:4860::8888", "[2001:4860:4860::8888]:53"},
+		{"[2001:4860:4860::8888]:53", "[2001:4860:4860::8888]:53"},
+	}
+)
+
+func (s *StoreSuite) TestNormalizeNameserver() {
+	for _, test := range NameserverTests {
+		normalized, err := netkat.NormalizeNameserver(test.Nameserver)
+		if err != nil {
+			s.T().Fatal(err)
+		}
+		assert.Equal(s.T(), test.Expected, normalized)
+	}
+	_, err := netkat.NormalizeNameserver("dns.google")
+	assert.Error(s.T(), err)
+}
+
+func (s *StoreSuite) TestResolver() {
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Qtype == dns.TypeA {
+			cname, _ := dns.NewRR("hello-world.info. 60 IN CNAME lb.hello-world.info.")
+			a, _ := dns.NewRR("lb.hello-world.info. 30 IN A 10.0.0.1")
+			b, _ := dns.NewRR("lb.hello-world.info. 30 IN A 10.0.0.2")
+			m.Answer = []dns.RR{cname, a, b}
+		} else {
+			// A failed AAAA lookup shouldn't lose the A records.
+			m.Rcode = dns.RcodeServerFailure
+		}
+		_ = w.WriteMsg(m)
+	})
+	for _, protocol := range []string{"udp", "tcp"} {
+		var server *dns.Server
+		var nameserver string
+		if protocol == "udp" {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				s.T().Fatal(err)
+			}
+			server = &dns.Server{PacketConn: conn, Handler: handler}
+			nameserver = conn.LocalAddr().String()
+		} else {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				s.T().Fatal(err)
+			}
+			server = &dns.Server{Listener: listener, Handler: handler}
+			nameserver = listener.Addr().String()
+		}
+		go func() { _ = server.ActivateAndServe() }()
+		resolver := netkat.Resolver{Nameservers: []string{nameserver}, Net: protocol}
+		records, cnameChain, err := resolver.Resolve("hello-world.info")
+		_ = server.Shutdown()
+		if err != nil {
+			s.T().Fatal(err)
+		}
+		assert.Equal(s.T(), []string{"lb.hello-world.info."}, cnameChain)
+		assert.Equal(s.T(), 2, len(records))
+		assert.Equal(s.T(), uint32(30), records[0].Ttl)
+	}
+}
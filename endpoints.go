@@ -0,0 +1,271 @@
+package netkat
+
+import (
+	"errors"
+	"github.com/go-kit/kit/log/level"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"net"
+)
+
+// The endpoint slice types below mirror the fields netkat reads from the discovery.k8s.io/v1 and
+// discovery.k8s.io/v1beta1 EndpointSlice APIs, which the pinned client-go does not provide.
+type (
+	EndpointSlice struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		AddressType       string              `json:"addressType"`
+		Endpoints         []SliceEndpoint     `json:"endpoints"`
+		Ports             []EndpointSlicePort `json:"ports,omitempty"`
+	}
+
+	EndpointSliceList struct {
+		GroupVersion string          `json:"-"`
+		Items        []EndpointSlice `json:"items"`
+	}
+
+	SliceEndpoint struct {
+		Addresses  []string            `json:"addresses"`
+		Conditions EndpointConditions  `json:"conditions,omitempty"`
+		TargetRef  *v1.ObjectReference `json:"targetRef,omitempty"`
+		NodeName   *string             `json:"nodeName,omitempty"`
+	}
+
+	// EndpointConditions leaves unknown conditions nil, which consumers treat as ready and not terminating.
+	EndpointConditions struct {
+		Ready       *bool `json:"ready,omitempty"`
+		Terminating *bool `json:"terminating,omitempty"`
+	}
+
+	EndpointSlicePort struct {
+		Name     *string `json:"name,omitempty"`
+		Protocol *string `json:"protocol,omitempty"`
+		Port     *int32  `json:"port,omitempty"`
+	}
+
+	// ServiceEndpoint is one address and port that Kubernetes publishes as a backend of a service port.
+	ServiceEndpoint struct {
+		ServiceName string `json:"serviceName,omitempty"`
+		Namespace   string `json:"namespace,omitempty"`
+		PortName    string `json:"portName,omitempty"`
+		Port        int32  `json:"port,omitempty"`
+		IpAddress   net.IP `json:"ipAddress,omitempty"`
+		PodName     string `json:"podName,omitempty"`
+		NodeName    string `json:"nodeName,omitempty"`
+		Ready       bool   `json:"ready"`
+		Terminating bool   `json:"terminating"`
+	}
+)
+
+const (
+	serviceNameLabel = "kubernetes.io/service-name"
+)
+
+var (
+	endpointSliceGroupVersions = []schema.GroupVersion{
+		{Group: "discovery.k8s.io", Version: "v1"},
+		{Group: "discovery.k8s.io", Version: "v1beta1"},
+	}
+)
+
+// EndpointSliceGroupVersion uses the discovery API to find the preferred EndpointSlice version served by the cluster.
+func (c *Client) EndpointSliceGroupVersion() (groupVersion schema.GroupVersion, err error) {
+	groupVersion, ok := c.preferredGroupVersion(endpointSliceGroupVersions, "endpointslices")
+	if !ok {
+		err = errors.New("the server does not serve any supported endpoint slice api version")
+	}
+	return
+}
+
+// GetServiceEndpoints lists the endpoint slices in the cluster, falling back to Endpoints on servers that
+// don't serve them.
+func (c *Client) GetServiceEndpoints() (serviceEndpoints []*ServiceEndpoint) {
+	groupVersion, err := c.EndpointSliceGroupVersion()
+	if err != nil {
+		return EndpointsToServiceEndpoints(c.GetEndpoints())
+	}
+	return EndpointSlicesToServiceEndpoints(c.GetEndpointSlices(groupVersion))
+}
+
+func (c *Client) GetEndpointSlices(groupVersion schema.GroupVersion) (apiEndpointSlices *EndpointSliceList) {
+	apiEndpointSlices = &EndpointSliceList{GroupVersion: groupVersion.String()}
+	unstructuredSlices, err := c.Dynamic.Resource(groupVersion.WithResource("endpointslices")).List(metav1.ListOptions{})
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		return
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredSlices.UnstructuredContent(), apiEndpointSlices)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+	}
+	return
+}
+
+func (c *Client) GetEndpoints() (apiEndpoints *v1.EndpointsList) {
+	apiEndpoints, err := c.CoreV1().Endpoints("").List(metav1.ListOptions{})
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+	}
+	return
+}
+
+func EndpointSlicesToServiceEndpoints(apiEndpointSlices *EndpointSliceList) (serviceEndpoints []*ServiceEndpoint) {
+	for _, slice := range apiEndpointSlices.Items {
+		serviceName, ok := slice.ObjectMeta.Labels[serviceNameLabel]
+		if !ok {
+			continue
+		}
+		for _, port := range slice.Ports {
+			var portName string
+			var portNumber int32
+			if port.Name != nil {
+				portName = *port.Name
+			}
+			if port.Port != nil {
+				portNumber = *port.Port
+			}
+			for _, endpoint := range slice.Endpoints {
+				ready := endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+				terminating := endpoint.Conditions.Terminating != nil && *endpoint.Conditions.Terminating
+				var nodeName string
+				if endpoint.NodeName != nil {
+					nodeName = *endpoint.NodeName
+				}
+				for _, address := range endpoint.Addresses {
+					serviceEndpoints = append(
+						serviceEndpoints,
+						&ServiceEndpoint{
+							ServiceName: serviceName,
+							Namespace:   slice.ObjectMeta.Namespace,
+							PortName:    portName,
+							Port:        portNumber,
+							IpAddress:   net.ParseIP(address),
+							PodName:     podName(endpoint.TargetRef),
+							NodeName:    nodeName,
+							Ready:       ready,
+							Terminating: terminating,
+						},
+					)
+				}
+			}
+		}
+	}
+	return
+}
+
+// EndpointsToServiceEndpoints converts Endpoints, which have no terminating condition, into service endpoints.
+func EndpointsToServiceEndpoints(apiEndpoints *v1.EndpointsList) (serviceEndpoints []*ServiceEndpoint) {
+	if apiEndpoints == nil {
+		return
+	}
+	for _, endpoints := range apiEndpoints.Items {
+		for _, subset := range endpoints.Subsets {
+			for _, port := range subset.Ports {
+				for _, address := range subset.Addresses {
+					serviceEndpoints = append(serviceEndpoints, endpointAddressToServiceEndpoint(&endpoints, port, address, true))
+				}
+				for _, address := range subset.NotReadyAddresses {
+					serviceEndpoints = append(serviceEndpoints, endpointAddressToServiceEndpoint(&endpoints, port, address, false))
+				}
+			}
+		}
+	}
+	return
+}
+
+func endpointAddressToServiceEndpoint(endpoints *v1.Endpoints, port v1.EndpointPort, address v1.EndpointAddress, ready bool) *ServiceEndpoint {
+	var nodeName string
+	if address.NodeName != nil {
+		nodeName = *address.NodeName
+	}
+	return &ServiceEndpoint{
+		ServiceName: endpoints.ObjectMeta.Name,
+		Namespace:   endpoints.ObjectMeta.Namespace,
+		PortName:    port.Name,
+		Port:        port.Port,
+		IpAddress:   net.ParseIP(address.IP),
+		PodName:     podName(address.TargetRef),
+		NodeName:    nodeName,
+		Ready:       ready,
+	}
+}
+
+// AttachServiceEndpoints adds each endpoint to the service port it was published for. Endpoint ports carry the
+// name of the service port, which is empty for single port services.
+func AttachServiceEndpoints(servicePorts []*ServicePort, serviceEndpoints []*ServiceEndpoint) {
+	for _, s := range servicePorts {
+		for _, e := range serviceEndpoints {
+			if e.Namespace == s.Namespace && e.ServiceName == s.ServiceName && e.PortName == s.SourcePortName {
+				s.Endpoints = append(s.Endpoints, e)
+			}
+		}
+	}
+}
+
+// FindEndpointMismatches compares the endpoints published for the service with the pods its selector matches.
+// Missing pods are selected by the service but aren't published as an endpoint at all, and unexpected endpoints
+// are ready but don't belong to a selected pod, such as manually managed endpoints. Whether the published pods are
+// ready is left to CheckStatusPod. Like the endpoints controller, pods without an IP, completed pods and pods
+// without the container port a named target port refers to are never expected. Container ports don't need to be
+// declared for numeric target ports.
+func (co *KubernetesComponents) FindEndpointMismatches(s *ServicePort) (missingPods []*Pod, unexpectedEndpoints []*ServiceEndpoint) {
+	publishedPods := make(map[string]bool)
+	for _, e := range s.Endpoints {
+		if e.PodName != "" {
+			publishedPods[e.PodName] = true
+		}
+	}
+	expectedPods := make(map[string]bool)
+	for _, p := range co.Pods {
+		if !s.selects(p.Namespace, p.Labels) || p.PodIP == nil || terminalPhase(p.PodStatus) {
+			continue
+		}
+		if _, ok := s.ResolveTargetPort(p); !ok {
+			continue
+		}
+		expectedPods[p.Name] = true
+		if !publishedPods[p.Name] {
+			missingPods = append(missingPods, p)
+		}
+	}
+	for _, e := range s.Endpoints {
+		if e.Ready && !e.Terminating && !expectedPods[e.PodName] {
+			unexpectedEndpoints = append(unexpectedEndpoints, e)
+		}
+	}
+	return
+}
+
+// PublishesPodPort reports whether the endpoint is the pod port, for services without a selector whose
+// endpoints are the only link to their pods.
+func (e *ServiceEndpoint) PublishesPodPort(p *PodPort) bool {
+	return e.Namespace == p.Namespace && e.PodName == p.PodName && e.Port == p.ContainerPort
+}
+
+func (s *ServicePort) ReadyEndpoints() (readyEndpoints []*ServiceEndpoint) {
+	for _, e := range s.Endpoints {
+		if e.Ready && !e.Terminating {
+			readyEndpoints = append(readyEndpoints, e)
+		}
+	}
+	return
+}
+
+func (e *ServiceEndpoint) State() string {
+	switch {
+	case e.Terminating:
+		return "terminating"
+	case e.Ready:
+		return "ready"
+	default:
+		return "not ready"
+	}
+}
+
+func podName(targetRef *v1.ObjectReference) string {
+	if targetRef == nil || targetRef.Kind != "Pod" {
+		return ""
+	}
+	return targetRef.Name
+}
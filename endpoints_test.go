@@ -0,0 +1,97 @@
+package netkat_test
+
+import (
+	"encoding/json"
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+)
+
+const EndpointSliceListJson = `{"items": [
+  {"metadata": {"name": "web-abc12", "namespace": "default", "labels": {"kubernetes.io/service-name": "web"}},
+   "addressType": "IPv4",
+   "ports": [{"name": "http", "port": 8080, "protocol": "TCP"}],
+   "endpoints": [
+     {"addresses": ["10.1.0.4"], "conditions": {"ready": true}, "nodeName": "node-1", "targetRef": {"kind": "Pod", "name": "web-a"}},
+     {"addresses": ["10.1.0.5"], "conditions": {"ready": false}, "targetRef": {"kind": "Pod", "name": "web-b"}},
+     {"addresses": ["10.1.0.6"], "conditions": {"ready": false, "terminating": true}, "targetRef": {"kind": "Pod", "name": "web-c"}}
+   ]},
+  {"metadata": {"name": "unowned", "namespace": "default"},
+   "addressType": "IPv4",
+   "ports": [{"port": 80}],
+   "endpoints": [{"addresses": ["10.1.0.9"]}]}
+]}`
+
+func (s *StoreSuite) TestEndpointSlicesToServiceEndpoints() {
+	var apiEndpointSlices netkat.EndpointSliceList
+	err := json.Unmarshal([]byte(EndpointSliceListJson), &apiEndpointSlices)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	serviceEndpoints := netkat.EndpointSlicesToServiceEndpoints(&apiEndpointSlices)
+	assert.Equal(s.T(), 3, len(serviceEndpoints))
+	assert.Equal(s.T(), "ready", serviceEndpoints[0].State())
+	assert.Equal(s.T(), "web-a", serviceEndpoints[0].PodName)
+	assert.Equal(s.T(), "node-1", serviceEndpoints[0].NodeName)
+	assert.Equal(s.T(), "not ready", serviceEndpoints[1].State())
+	assert.Equal(s.T(), "terminating", serviceEndpoints[2].State())
+}
+
+func (s *StoreSuite) TestEndpointsToServiceEndpoints() {
+	apiEndpoints := v1.EndpointsList{Items: []v1.Endpoints{{
+		ObjectMeta: metav1.ObjectMeta{Name: "external-db", Namespace: "default"},
+		Subsets: []v1.EndpointSubset{{
+			Addresses:         []v1.EndpointAddress{{IP: "192.168.1.10"}},
+			NotReadyAddresses: []v1.EndpointAddress{{IP: "192.168.1.11"}},
+			Ports:             []v1.EndpointPort{{Port: 5432}},
+		}},
+	}}}
+	serviceEndpoints := netkat.EndpointsToServiceEndpoints(&apiEndpoints)
+	assert.Equal(s.T(), 2, len(serviceEndpoints))
+	assert.True(s.T(), serviceEndpoints[0].Ready)
+	assert.False(s.T(), serviceEndpoints[1].Ready)
+	assert.Equal(s.T(), "external-db", serviceEndpoints[0].ServiceName)
+}
+
+func (s *StoreSuite) TestFindEndpointMismatches() {
+	web := map[string]string{"app": "web"}
+	components := netkat.KubernetesComponents{
+		PodPorts: []*netkat.PodPort{
+			{PodName: "web-a", Namespace: "default", Labels: web, ContainerPort: 8080},
+		},
+		Pods: []*netkat.Pod{
+			{Name: "web-a", Namespace: "default", Labels: web, PodStatus: "Running", PodIP: net.ParseIP("10.1.0.4")},
+			// web-b doesn't declare its container port, and is published as not ready.
+			{Name: "web-b", Namespace: "default", Labels: web, PodStatus: "Running", PodIP: net.ParseIP("10.1.0.5")},
+			{Name: "web-c", Namespace: "default", Labels: web, PodStatus: "Running", PodIP: net.ParseIP("10.1.0.6")},
+			{Name: "web-pending", Namespace: "default", Labels: web, PodStatus: "Pending"},
+			{Name: "web-migrate", Namespace: "default", Labels: web, PodStatus: "Succeeded", PodIP: net.ParseIP("10.1.0.7")},
+		},
+	}
+	servicePort := netkat.ServicePort{ServiceName: "web", Namespace: "default", Selector: web, SourcePort: 80, TargetPort: 8080}
+	netkat.AttachServiceEndpoints([]*netkat.ServicePort{&servicePort}, []*netkat.ServiceEndpoint{
+		{ServiceName: "web", Namespace: "default", Port: 8080, PodName: "web-a", Ready: true},
+		{ServiceName: "web", Namespace: "default", Port: 8080, PodName: "web-b", Ready: false},
+		{ServiceName: "web", Namespace: "default", Port: 8080, Ready: true},
+		{ServiceName: "other", Namespace: "default", Port: 8080, PodName: "other-a", Ready: true},
+	})
+	assert.Equal(s.T(), 3, len(servicePort.Endpoints))
+	missingPods, unexpectedEndpoints := components.FindEndpointMismatches(&servicePort)
+	assert.Equal(s.T(), 1, len(missingPods))
+	assert.Equal(s.T(), "web-c", missingPods[0].Name)
+	assert.Equal(s.T(), 1, len(unexpectedEndpoints))
+
+	named := netkat.ServicePort{ServiceName: "web", Namespace: "default", Selector: web, SourcePort: 80, TargetPortName: "http", Endpoints: servicePort.Endpoints}
+	missingPods, _ = components.FindEndpointMismatches(&named)
+	assert.Empty(s.T(), missingPods, "Expected pods without the named port not to be expected")
+
+	selectorless := netkat.ServicePort{ServiceName: "web-manual", Namespace: "default", SourcePort: 80}
+	selectorless.Endpoints = []*netkat.ServiceEndpoint{{ServiceName: "web-manual", Namespace: "default", Port: 8080, PodName: "web-a", Ready: true}}
+	podPorts, err := components.FindPodPortForServicePort(&selectorless)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.Equal(s.T(), "web-a", podPorts[0].PodName)
+}
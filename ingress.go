@@ -0,0 +1,401 @@
+package netkat
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log/level"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// The ingress types below mirror the fields netkat reads from the networking.k8s.io/v1,
+// networking.k8s.io/v1beta1 and extensions/v1beta1 Ingress APIs, so whichever version the
+// server serves can be decoded into one shape before being normalised into IngressPaths.
+type (
+	Ingress struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		Spec              IngressSpec   `json:"spec,omitempty"`
+		Status            IngressStatus `json:"status,omitempty"`
+	}
+
+	IngressList struct {
+		GroupVersion string    `json:"-"`
+		Items        []Ingress `json:"items"`
+	}
+
+	IngressSpec struct {
+		IngressClassName *string         `json:"ingressClassName,omitempty"`
+		DefaultBackend   *IngressBackend `json:"defaultBackend,omitempty"`
+		Backend          *IngressBackend `json:"backend,omitempty"`
+		Rules            []IngressRule   `json:"rules,omitempty"`
+	}
+
+	IngressRule struct {
+		Host string                `json:"host,omitempty"`
+		HTTP *HTTPIngressRuleValue `json:"http,omitempty"`
+	}
+
+	HTTPIngressRuleValue struct {
+		Paths []HTTPIngressPath `json:"paths"`
+	}
+
+	HTTPIngressPath struct {
+		Path     string         `json:"path,omitempty"`
+		PathType *string        `json:"pathType,omitempty"`
+		Backend  IngressBackend `json:"backend"`
+	}
+
+	// IngressBackend holds both the v1 service backend and the v1beta1 serviceName/servicePort pair.
+	IngressBackend struct {
+		Service     *IngressServiceBackend `json:"service,omitempty"`
+		ServiceName string                 `json:"serviceName,omitempty"`
+		ServicePort intstr.IntOrString     `json:"servicePort,omitempty"`
+	}
+
+	IngressServiceBackend struct {
+		Name string             `json:"name"`
+		Port ServiceBackendPort `json:"port,omitempty"`
+	}
+
+	ServiceBackendPort struct {
+		Name   string `json:"name,omitempty"`
+		Number int32  `json:"number,omitempty"`
+	}
+
+	IngressStatus struct {
+		LoadBalancer v1.LoadBalancerStatus `json:"loadBalancer,omitempty"`
+	}
+
+	// IngressClass mirrors the networking.k8s.io/v1 and v1beta1 IngressClass APIs.
+	IngressClass struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		Spec              IngressClassSpec `json:"spec,omitempty"`
+	}
+
+	IngressClassList struct {
+		GroupVersion string         `json:"-"`
+		Items        []IngressClass `json:"items"`
+	}
+
+	IngressClassSpec struct {
+		Controller string `json:"controller,omitempty"`
+	}
+
+	// IngressPathMatch records how an ingress path was evaluated against the target path.
+	IngressPathMatch struct {
+		IngressPath    *IngressPath
+		Matched        bool
+		Semantics      string
+		HostPrecedence int
+		Reason         string
+	}
+)
+
+const (
+	ingressClassAnnotation        = "kubernetes.io/ingress.class"
+	defaultIngressClassAnnotation = "ingressclass.kubernetes.io/is-default-class"
+	nginxUseRegexAnnotation       = "nginx.ingress.kubernetes.io/use-regex"
+	nginxRewriteTargetAnnotation  = "nginx.ingress.kubernetes.io/rewrite-target"
+
+	PathTypeExact                  = "Exact"
+	PathTypePrefix                 = "Prefix"
+	PathTypeImplementationSpecific = "ImplementationSpecific"
+)
+
+var (
+	ingressGroupVersions = []schema.GroupVersion{
+		{Group: "networking.k8s.io", Version: "v1"},
+		{Group: "networking.k8s.io", Version: "v1beta1"},
+		{Group: "extensions", Version: "v1beta1"},
+	}
+	ingressClassGroupVersions = []schema.GroupVersion{
+		{Group: "networking.k8s.io", Version: "v1"},
+		{Group: "networking.k8s.io", Version: "v1beta1"},
+	}
+)
+
+// IngressGroupVersion uses the discovery API to find the preferred Ingress version served by the cluster.
+func (c *Client) IngressGroupVersion() (groupVersion schema.GroupVersion, err error) {
+	groupVersion, ok := c.preferredGroupVersion(ingressGroupVersions, "ingresses")
+	if !ok {
+		err = errors.New("the server does not serve any supported ingress api version")
+	}
+	return
+}
+
+// preferredGroupVersion returns the first of the group versions serving the resource, the group versions being
+// listed in order of preference.
+func (c *Client) preferredGroupVersion(groupVersions []schema.GroupVersion, resource string) (groupVersion schema.GroupVersion, ok bool) {
+	for _, gv := range groupVersions {
+		resources, discoveryErr := c.Discovery().ServerResourcesForGroupVersion(gv.String())
+		if discoveryErr != nil {
+			continue
+		}
+		for _, r := range resources.APIResources {
+			if r.Name == resource {
+				return gv, true
+			}
+		}
+	}
+	return
+}
+
+// GetIngressClasses lists the IngressClasses, returning none on clusters older than 1.18 which don't serve them.
+func (c *Client) GetIngressClasses() (apiIngressClasses *IngressClassList) {
+	apiIngressClasses = &IngressClassList{}
+	groupVersion, ok := c.preferredGroupVersion(ingressClassGroupVersions, "ingressclasses")
+	if !ok {
+		return
+	}
+	apiIngressClasses.GroupVersion = groupVersion.String()
+	unstructuredIngressClasses, err := c.Dynamic.Resource(groupVersion.WithResource("ingressclasses")).List(metav1.ListOptions{})
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		return
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredIngressClasses.UnstructuredContent(), apiIngressClasses)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+	}
+	return
+}
+
+// AttachIngressClassControllers sets the controller of each ingress path's IngressClass, taking the class marked
+// as the default for ingresses without one. Classes only named by the legacy annotation have no object.
+func AttachIngressClassControllers(ingressPaths []*IngressPath, apiIngressClasses *IngressClassList) {
+	controllers := make(map[string]string)
+	var defaultController string
+	for _, class := range apiIngressClasses.Items {
+		controllers[class.Name] = class.Spec.Controller
+		if class.Annotations[defaultIngressClassAnnotation] == "true" {
+			defaultController = class.Spec.Controller
+		}
+	}
+	for _, i := range ingressPaths {
+		switch {
+		case i.Kind == IngressRouteKind:
+			continue
+		case i.IngressClassName == "":
+			i.IngressClassController = defaultController
+		default:
+			i.IngressClassController = controllers[i.IngressClassName]
+		}
+	}
+}
+
+// ServiceBackend returns the service name and port of the backend for either API version.
+func (b *IngressBackend) ServiceBackend() (name string, port intstr.IntOrString) {
+	if b.Service != nil {
+		if b.Service.Port.Name != "" {
+			return b.Service.Name, intstr.FromString(b.Service.Port.Name)
+		}
+		return b.Service.Name, intstr.FromInt(int(b.Service.Port.Number))
+	}
+	return b.ServiceName, b.ServicePort
+}
+
+// ClassName returns spec.ingressClassName, falling back to the legacy ingress class annotation.
+func (i *Ingress) ClassName() string {
+	if i.Spec.IngressClassName != nil {
+		return *i.Spec.IngressClassName
+	}
+	return i.ObjectMeta.Annotations[ingressClassAnnotation]
+}
+
+// DefaultBackend returns spec.defaultBackend, or spec.backend for v1beta1 ingresses.
+func (i *Ingress) DefaultBackend() *IngressBackend {
+	if i.Spec.DefaultBackend != nil {
+		return i.Spec.DefaultBackend
+	}
+	return i.Spec.Backend
+}
+
+// LoadBalancerAddresses returns every IP and hostname in the ingress load balancer status. Pending ingresses
+// have neither.
+func (i *Ingress) LoadBalancerAddresses() (ipAddresses []net.IP, hostnames []string) {
+	for _, lb := range i.Status.LoadBalancer.Ingress {
+		if ip := net.ParseIP(lb.IP); ip != nil {
+			ipAddresses = append(ipAddresses, ip)
+		}
+		if lb.Hostname != "" {
+			hostnames = append(hostnames, lb.Hostname)
+		}
+	}
+	return
+}
+
+// ResolveLoadBalancerHostnames adds the addresses of hostname based load balancers, such as AWS ELBs, to the
+// ingress paths so they can be matched against the target address. Ingresses without a load balancer address
+// yet can't be matched against any address, so they're logged as a warning.
+func ResolveLoadBalancerHostnames(ingressPaths []*IngressPath) {
+	resolved := make(map[string][]net.IP)
+	pending := make(map[string]bool)
+	for _, i := range ingressPaths {
+		if len(i.IpAddresses) == 0 && len(i.LoadBalancerHostnames) == 0 {
+			name := fmt.Sprintf("%s/%s", i.Namespace, i.IngressName)
+			if !pending[name] {
+				pending[name] = true
+				_ = level.Warn(Logger).Log("msg", fmt.Sprintf("%s %s has no load balancer address yet", ingressKind(i), name))
+			}
+			continue
+		}
+		if len(i.LoadBalancerHostnames) == 0 {
+			continue
+		}
+		// The addresses are shared between the paths of an ingress, so they're copied before appending.
+		ipAddresses := append([]net.IP{}, i.IpAddresses...)
+		for _, hostname := range i.LoadBalancerHostnames {
+			hostnameAddresses, ok := resolved[hostname]
+			if !ok {
+				var err error
+				hostnameAddresses, err = net.LookupIP(hostname)
+				if err != nil {
+					_ = level.Error(Logger).Log("msg", err)
+				}
+				resolved[hostname] = hostnameAddresses
+			}
+			ipAddresses = append(ipAddresses, hostnameAddresses...)
+		}
+		i.IpAddresses = ipAddresses
+	}
+}
+
+func (i *IngressPath) HasAddress(ip net.IP) bool {
+	for _, address := range i.IpAddresses {
+		if address.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchHost follows the Kubernetes host rules: a wildcard host matches exactly one DNS label, a rule without a
+// host matches every host, and the returned precedence ranks exact hosts over wildcards over empty hosts.
+func (i *IngressPath) MatchHost(host string) (matched bool, precedence int) {
+	switch {
+	case i.Host == "":
+		return true, 0
+	case strings.HasPrefix(i.Host, "*."):
+		suffix := strings.ToLower(i.Host[1:])
+		label := strings.TrimSuffix(strings.ToLower(host), suffix)
+		return strings.HasSuffix(strings.ToLower(host), suffix) && label != "" && !strings.Contains(label, "."), 1
+	default:
+		return strings.EqualFold(i.Host, host), 2
+	}
+}
+
+// MatchPath evaluates the request path against the ingress path. Exact and Prefix follow the Kubernetes
+// semantics; ImplementationSpecific paths, and paths without a type, follow the rules of the ingress controller.
+func (i *IngressPath) MatchPath(path string) (matched bool, semantics string) {
+	ingressPath := i.Path
+	if ingressPath == "" {
+		ingressPath = "/"
+	}
+	switch i.PathType {
+	case PathTypeExact:
+		return path == ingressPath, "exact"
+	case PathTypePrefix:
+		return matchPathPrefix(ingressPath, path), "prefix"
+	}
+	controller := IngressControllerFor(i)
+	switch {
+	case controller == IngressControllerNginx && i.usesNginxRegex():
+		// ingress-nginx renders regex locations as case insensitive and anchored at the start of the path.
+		re, err := regexp.Compile("(?i)^" + ingressPath)
+		if err != nil {
+			return false, "nginx regex (invalid)"
+		}
+		return re.MatchString(path), "nginx regex"
+	case controller == IngressControllerNginx:
+		return strings.HasPrefix(path, ingressPath), "nginx string prefix"
+	case controller == IngressControllerTraefik:
+		return strings.HasPrefix(path, ingressPath), "traefik string prefix"
+	case strings.HasPrefix(strings.ToLower(i.IngressClassName), "gce"):
+		if strings.HasSuffix(ingressPath, "/*") {
+			base := strings.TrimSuffix(ingressPath, "/*")
+			return path == base || strings.HasPrefix(path, base+"/"), "gce glob"
+		}
+		return path == ingressPath, "gce exact"
+	default:
+		return matchPathPrefix(ingressPath, path), "prefix"
+	}
+}
+
+func (i *IngressPath) usesNginxRegex() bool {
+	if i.Annotations[nginxUseRegexAnnotation] == "true" {
+		return true
+	}
+	_, ok := i.Annotations[nginxRewriteTargetAnnotation]
+	return ok
+}
+
+// matchPathPrefix matches element by element on the path split by '/', so /foo matches /foo/bar but not /foobar.
+func matchPathPrefix(prefix string, path string) bool {
+	prefixElements := splitPath(prefix)
+	pathElements := splitPath(path)
+	if len(prefixElements) > len(pathElements) {
+		return false
+	}
+	for n, element := range prefixElements {
+		if pathElements[n] != element {
+			return false
+		}
+	}
+	return true
+}
+
+func splitPath(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+// sortIngressPathMatches orders matches by precedence: matching paths first, then the most specific host,
+// then the longest path, then Exact over other path types.
+func sortIngressPathMatches(matches []*IngressPathMatch) {
+	sort.SliceStable(matches, func(a, b int) bool {
+		if matches[a].Matched != matches[b].Matched {
+			return matches[a].Matched
+		}
+		if matches[a].HostPrecedence != matches[b].HostPrecedence {
+			return matches[a].HostPrecedence > matches[b].HostPrecedence
+		}
+		if longer := comparePathLength(matches[a].IngressPath, matches[b].IngressPath); longer != 0 {
+			return longer > 0
+		}
+		return matches[a].IngressPath.PathType == PathTypeExact && matches[b].IngressPath.PathType != PathTypeExact
+	})
+}
+
+// comparePathLength ranks paths by their number of elements, as the Ingress spec does, so the Prefix paths /foo
+// and /foo/ are equally long. Paths with controller specific semantics are then ranked by their raw length.
+func comparePathLength(a *IngressPath, b *IngressPath) int {
+	aElements, bElements := len(splitPath(a.Path)), len(splitPath(b.Path))
+	if aElements != bElements {
+		return aElements - bElements
+	}
+	if a.hasSpecPathType() && b.hasSpecPathType() {
+		return 0
+	}
+	return len(a.Path) - len(b.Path)
+}
+
+func (i *IngressPath) hasSpecPathType() bool {
+	return i.PathType == PathTypeExact || i.PathType == PathTypePrefix
+}
+
+// samePrecedence reports whether neither match would be preferred over the other.
+func samePrecedence(a *IngressPathMatch, b *IngressPathMatch) bool {
+	return a.Matched && b.Matched &&
+		comparePathLength(a.IngressPath, b.IngressPath) == 0 &&
+		(a.IngressPath.PathType == PathTypeExact) == (b.IngressPath.PathType == PathTypeExact)
+}
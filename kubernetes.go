@@ -1,89 +1,289 @@
 package netkat
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"github.com/go-kit/kit/log/level"
 	"k8s.io/api/core/v1"
-	"k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/tools/portforward"
-	"k8s.io/client-go/transport/spdy"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"net"
-	"net/http"
-	"net/url"
-	"strings"
-	"sync"
 )
 
 type (
 	PodPort struct {
-		PodName        string `json:"name,omitempty"`
-		Namespace      string `json:"namespace,omitempty"`
-		App            string
-		ContainerImage string `json:"image,omitempty"`
-		ContainerName  string `json:"name,omitempty"`
-		PortName       string `json:"name,omitempty"`
-		HostPort       int32  `json:"hostPort,omitempty"`
-		ContainerPort  int32  `json:"containerPort,omitempty"`
-		Protocol       string `json:"protocol,omitempty"`
-		HostIP         net.IP `json:"hostIP,omitempty"`
+		PodName        string            `json:"name,omitempty"`
+		Namespace      string            `json:"namespace,omitempty"`
+		Labels         map[string]string `json:"labels,omitempty"`
+		ContainerImage string            `json:"image,omitempty"`
+		ContainerName  string            `json:"containerName,omitempty"`
+		PortName       string            `json:"portName,omitempty"`
+		HostPort       int32             `json:"hostPort,omitempty"`
+		ContainerPort  int32             `json:"containerPort,omitempty"`
+		Protocol       string            `json:"protocol,omitempty"`
+		HostIP         net.IP            `json:"hostIP,omitempty"`
+		PodIP          net.IP            `json:"podIP,omitempty"`
+		Hostname       string            `json:"hostname,omitempty"`
+		Subdomain      string            `json:"subdomain,omitempty"`
+		NodeName       string            `json:"nodeName,omitempty"`
 		ServicePort    ServicePort
 		PodStatus      string `json:"status,omitempty"`
+		Ready          bool   `json:"ready"`
+		ReadyReason    string `json:"readyReason,omitempty"`
+		// Containers holds the health of every container in the pod, sidecars included.
+		Containers []ContainerHealth `json:"containers,omitempty"`
+		// Args are the command and arguments of the container, where controllers take their settings from.
+		Args []string `json:"args,omitempty"`
+	}
+
+	// Pod is one entry per pod, so pods that declare no container ports, and have no PodPorts, are still seen.
+	Pod struct {
+		Name      string            `json:"name,omitempty"`
+		Namespace string            `json:"namespace,omitempty"`
+		Labels    map[string]string `json:"labels,omitempty"`
+		PodStatus string            `json:"status,omitempty"`
+		// PortNumbers maps the names of the container ports to their numbers.
+		PortNumbers map[string]int32 `json:"portNumbers,omitempty"`
+		// PodIP is empty until the pod is scheduled and its sandbox started.
+		PodIP net.IP `json:"podIP,omitempty"`
 	}
 
 	ServicePort struct {
 		Type           string `json:"type,omitempty"`
 		ClusterIP      net.IP `json:"clusterIP,omitempty"`
+		Headless       bool
 		ServiceName    string `json:"name,omitempty"`
 		Namespace      string `json:"namespace,omitempty"`
 		ExternalIP     net.IP
-		AppSelector    string
+		Selector       map[string]string `json:"selector,omitempty"`
 		Host           string
-		SourcePortName string `json:"name,omitempty"`
+		SourcePortName string `json:"portName,omitempty"`
 		Protocol       string `json:"protocol,omitempty"`
 		SourcePort     int32  `json:"port,omitempty"`
 		NodePort       int32  `json:"nodePort,omitempty"`
 		TargetPort     int32  `json:"targetPort,omitempty"`
-		TargetPortName string `json:"targetPort,omitempty"`
-		IngressPath    IngressPath
-		PodPort        []*PodPort
+		TargetPortName string `json:"targetPortName,omitempty"`
+		AppProtocol    string `json:"appProtocol,omitempty"`
+		// ExternalHostname is set instead of ExternalIP by load balancers addressed by name, such as AWS ELBs.
+		ExternalHostname string
+		// SourceRanges restrict the clients of a LoadBalancer service, set in the spec or by annotation.
+		SourceRanges          []string
+		SourceRangesFrom      string
+		ExternalTrafficPolicy string
+		IngressPath           IngressPath
+		PodPort               []*PodPort
+		// Endpoints are the ready, not ready and terminating backends Kubernetes publishes for the port.
+		Endpoints []*ServiceEndpoint
+		// ResolvedTargetPorts maps the selected pods to the container port a named target port resolves to.
+		ResolvedTargetPorts map[string]int32
+		// Labels are the service's own labels, not its selector.
+		Labels map[string]string
 	}
 
 	IngressPath struct {
-		Host           string `json:"host,omitempty"`
-		IpAddress      net.IP `json:"ipAddress,omitempty"`
-		Namespace      string `json:"namespace,omitempty"`
-		IngressName    string `json:"name,omitempty"`
-		Path           string `json:"path,omitempty"`
-		ServiceName    string `json:"serviceName,omitempty"`
-		ServiceIntPort int32  `json:"servicePort,omitempty"`
-		ServiceStrPort string `json:"servicePort,omitempty"`
-		Service        []*ServicePort
+		Host                  string            `json:"host,omitempty"`
+		IpAddresses           []net.IP          `json:"ipAddresses,omitempty"`
+		LoadBalancerHostnames []string          `json:"loadBalancerHostnames,omitempty"`
+		Namespace             string            `json:"namespace,omitempty"`
+		IngressName           string            `json:"name,omitempty"`
+		Path                  string            `json:"path,omitempty"`
+		DefaultBackend        bool              `json:"defaultBackend,omitempty"`
+		PathType              string            `json:"pathType,omitempty"`
+		IngressClassName      string            `json:"ingressClassName,omitempty"`
+		Annotations           map[string]string `json:"annotations,omitempty"`
+		ServiceName           string            `json:"serviceName,omitempty"`
+		ServiceIntPort        int32             `json:"servicePort,omitempty"`
+		ServiceStrPort        string            `json:"servicePortName,omitempty"`
+		Service               []*ServicePort
+		// Kind is IngressRouteKind for paths read from Traefik IngressRoutes, and empty for Ingresses.
+		Kind string `json:"kind,omitempty"`
+		// IngressClassController is the spec.controller of the path's IngressClass, or of the default
+		// IngressClass when the ingress has no class.
+		IngressClassController string `json:"ingressClassController,omitempty"`
+	}
+
+	// ServiceAppProtocolList mirrors the service port appProtocol field, which the pinned client-go drops.
+	ServiceAppProtocolList struct {
+		Items []ServiceAppProtocols `json:"items"`
+	}
+
+	ServiceAppProtocols struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		Spec              struct {
+			Ports []struct {
+				Name        string `json:"name,omitempty"`
+				AppProtocol string `json:"appProtocol,omitempty"`
+			} `json:"ports,omitempty"`
+		} `json:"spec,omitempty"`
 	}
 
 	KubernetesComponents struct {
-		IngressPaths []*IngressPath
-		ServicePorts []*ServicePort
-		PodPorts     []*PodPort
+		IngressPaths    []*IngressPath
+		ServicePorts    []*ServicePort
+		PodPorts        []*PodPort
+		Pods            []*Pod
+		NetworkPolicies []NetworkPolicy
+		NamespaceLabels map[string]map[string]string
+		Middlewares     []Middleware
+		// NetworkPolicyErr is set when the network policies or namespaces couldn't be listed, such as when RBAC
+		// forbids it, so the policies can't be evaluated.
+		NetworkPolicyErr error
 	}
 )
 
-func (co *KubernetesComponents) FindIngressPathForHost(t *Target) (ingressPath *IngressPath, err error) {
-	var ingressPaths []*IngressPath
+// SelectsPod applies the service's label selector to the pod's labels. Like kube-proxy, a service
+// without a selector selects no pods.
+func (s *ServicePort) SelectsPod(p *PodPort) bool {
+	return s.selects(p.Namespace, p.Labels)
+}
+
+func (s *ServicePort) selects(namespace string, podLabels map[string]string) bool {
+	if s.Namespace != namespace || len(s.Selector) == 0 {
+		return false
+	}
+	return labels.SelectorFromSet(s.Selector).Matches(labels.Set(podLabels))
+}
+
+// ResolveTargetPort returns the container port number the service targets on the pod, which for a named target
+// port is only known when the pod declares a container port with that name.
+func (s *ServicePort) ResolveTargetPort(p *Pod) (port int32, ok bool) {
+	if s.TargetPortName == "" {
+		return s.TargetPort, true
+	}
+	port, ok = p.PortNumbers[s.TargetPortName]
+	return
+}
+
+// key identifies the pod the port belongs to, as a pod has a PodPort for every container port.
+func (p *PodPort) key() string {
+	return p.Namespace + "/" + p.PodName
+}
+
+// uniquePods keeps the first PodPort of each pod.
+func uniquePods(podPorts []*PodPort) (pods []*PodPort) {
+	seen := make(map[string]bool)
+	for _, p := range podPorts {
+		if !seen[p.key()] {
+			seen[p.key()] = true
+			pods = append(pods, p)
+		}
+	}
+	return
+}
+
+// TargetsPodPort reports whether the service sends traffic to the pod port. Named target ports are resolved per
+// pod, so the same name can map to different container port numbers on different pods.
+func (s *ServicePort) TargetsPodPort(p *PodPort) bool {
+	if s.TargetPortName != "" {
+		return s.TargetPortName == p.PortName
+	}
+	return s.TargetPort == p.ContainerPort
+}
+
+// TargetsServicePort reports whether the ingress backend refers to the service port, by port name when the
+// backend uses a named port and by port number otherwise.
+func (i *IngressPath) TargetsServicePort(s *ServicePort) bool {
+	if i.Namespace != s.Namespace || i.ServiceName != s.ServiceName {
+		return false
+	}
+	if i.ServiceStrPort != "" {
+		return i.ServiceStrPort == s.SourcePortName
+	}
+	return i.ServiceIntPort == s.SourcePort
+}
+
+// MatchIngressPaths evaluates every ingress rule for the target host against the target path, ordered by
+// precedence, and explains why each candidate was or wasn't chosen. Only the most specific matching host is
+// considered, and when none of its paths match, the request falls back to an ingress default backend.
+func (co *KubernetesComponents) MatchIngressPaths(t *Target) (matches []*IngressPathMatch) {
+	hostPrecedence := -1
 	for _, i := range co.IngressPaths {
-		if t.Host == i.Host && t.Path == i.Path && t.IpAddress.Equal(i.IpAddress) {
-			ingressPaths = append(ingressPaths, i)
+		if i.DefaultBackend || !i.HasAddress(t.IpAddress) {
+			continue
+		}
+		if hostMatched, precedence := i.MatchHost(t.Host); hostMatched {
+			matched, semantics := i.MatchPath(t.Path)
+			matches = append(matches, &IngressPathMatch{IngressPath: i, Matched: matched, Semantics: semantics, HostPrecedence: precedence})
+			if precedence > hostPrecedence {
+				hostPrecedence = precedence
+			}
+		}
+	}
+	for _, m := range matches {
+		if m.HostPrecedence < hostPrecedence {
+			m.Matched = false
 		}
 	}
+	sortIngressPathMatches(matches)
+	if len(matches) == 0 || !matches[0].Matched {
+		if defaultBackend := co.findDefaultBackend(t, matches); defaultBackend != nil {
+			matches = append([]*IngressPathMatch{defaultBackend}, matches...)
+		}
+	}
+	for n, m := range matches {
+		switch {
+		case m.IngressPath.DefaultBackend:
+			m.Reason = fmt.Sprintf("chosen, no rule matched %s%s so the request falls back to the default backend of ingress %s", t.Host, t.Path, m.IngressPath.IngressName)
+		case m.HostPrecedence < hostPrecedence:
+			m.Reason = fmt.Sprintf("host '%s' is less specific than another rule matching %s", m.IngressPath.Host, t.Host)
+		case !m.Matched:
+			m.Reason = fmt.Sprintf("%s match failed for %s", m.Semantics, t.Path)
+		case n == 0 && (len(matches) == 1 || !matches[1].Matched):
+			m.Reason = fmt.Sprintf("chosen, only path with a %s match for %s", m.Semantics, t.Path)
+		case n == 0:
+			m.Reason = fmt.Sprintf("chosen, longest path with a %s match for %s", m.Semantics, t.Path)
+		case samePrecedence(matches[0], m):
+			m.Reason = fmt.Sprintf("%s match, conflicts with %s in ingress %s", m.Semantics, matches[0].IngressPath.Path, matches[0].IngressPath.IngressName)
+		default:
+			m.Reason = fmt.Sprintf("%s match, but %s is more specific", m.Semantics, matches[0].IngressPath.Path)
+		}
+	}
+	return
+}
+
+// findDefaultBackend prefers the default backend of an ingress that defines rules for the host, then any
+// default backend served from the target address.
+func (co *KubernetesComponents) findDefaultBackend(t *Target, matches []*IngressPathMatch) (defaultBackend *IngressPathMatch) {
+	var fallback *IngressPath
+	for _, i := range co.IngressPaths {
+		if !i.DefaultBackend || !i.HasAddress(t.IpAddress) {
+			continue
+		}
+		for _, m := range matches {
+			if m.IngressPath.Namespace == i.Namespace && m.IngressPath.IngressName == i.IngressName {
+				return &IngressPathMatch{IngressPath: i, Matched: true, Semantics: "default backend"}
+			}
+		}
+		if fallback == nil {
+			fallback = i
+		}
+	}
+	if fallback != nil {
+		defaultBackend = &IngressPathMatch{IngressPath: fallback, Matched: true, Semantics: "default backend"}
+	}
+	return
+}
+
+func (co *KubernetesComponents) FindIngressPathForHost(t *Target) (ingressPath *IngressPath, err error) {
+	matches := co.MatchIngressPaths(t)
 	switch {
-	case len(ingressPaths) > 1:
-		err = errors.New("found more than one ingress resource matching the host")
-	case len(ingressPaths) == 0:
+	case len(matches) == 0 || !matches[0].Matched:
 		err = errors.New("could not find ingress resource matching the host")
+	case len(matches) > 1 && samePrecedence(matches[0], matches[1]):
+		err = errors.New("found more than one ingress resource matching the host")
 	default:
-		ingressPath = ingressPaths[0]
+		ingressPath = matches[0].IngressPath
+	}
+	return
+}
+
+// FindRouteForAddress finds the ingress, or failing that the service, that serves the host on the address.
+func (co *KubernetesComponents) FindRouteForAddress(t *Target, ip net.IP) (ingressPath *IngressPath, servicePort *ServicePort) {
+	addressTarget := t.ForAddress(ip)
+	ingressPath, _ = co.FindIngressPathForHost(addressTarget)
+	if ingressPath == nil {
+		servicePort, _ = co.FindServicePortForHost(addressTarget)
 	}
 	return
 }
@@ -109,7 +309,7 @@ func (co *KubernetesComponents) FindServicePortForHost(t *Target) (servicePort *
 func (co *KubernetesComponents) FindServicePortForIngressPath(i *IngressPath) (servicePort *ServicePort, err error) {
 	var servicePorts []*ServicePort
 	for _, s := range co.ServicePorts {
-		if i.Namespace == s.Namespace && i.ServiceName == s.ServiceName && (i.ServiceIntPort == s.SourcePort || i.ServiceStrPort == s.SourcePortName) {
+		if i.TargetsServicePort(s) {
 			servicePorts = append(servicePorts, s)
 		}
 	}
@@ -124,33 +324,118 @@ func (co *KubernetesComponents) FindServicePortForIngressPath(i *IngressPath) (s
 	return
 }
 
+// FindPodPortForServicePort finds the pods the service selects. Services without a selector are followed
+// through their endpoints instead.
 func (co *KubernetesComponents) FindPodPortForServicePort(s *ServicePort) (podPorts []*PodPort, err error) {
 	for _, p := range co.PodPorts {
-		if s.Namespace == p.Namespace && s.AppSelector == p.App && (s.TargetPort == p.ContainerPort || s.TargetPortName == p.PortName) {
+		if len(s.Selector) == 0 {
+			for _, e := range s.Endpoints {
+				if e.PublishesPodPort(p) {
+					podPorts = append(podPorts, p)
+					break
+				}
+			}
+		} else if s.SelectsPod(p) && s.TargetsPodPort(p) {
 			podPorts = append(podPorts, p)
 		}
 	}
-	if len(podPorts) == 0 {
+	switch {
+	case len(podPorts) > 0:
+		return
+	case len(s.Selector) == 0:
+		err = errors.New("service has no selector and none of its endpoints are pods in the cluster")
+	default:
 		err = errors.New("could not find pod port matching the service port")
 	}
 	return
 }
 
-func (co *KubernetesComponents) FindPodPort(n string) (podPort *PodPort, err error) {
+// FindPodsMissingTargetPort returns the pods selected by a service with a named target port that have no
+// container port with that name, including pods that declare no container ports at all.
+func (co *KubernetesComponents) FindPodsMissingTargetPort(s *ServicePort) (podNames []string) {
+	if s.TargetPortName == "" {
+		return
+	}
+	for _, p := range co.Pods {
+		if !s.selects(p.Namespace, p.Labels) || terminalPhase(p.PodStatus) {
+			continue
+		}
+		if _, ok := s.ResolveTargetPort(p); !ok {
+			podNames = append(podNames, p.Name)
+		}
+	}
+	return
+}
+
+// AttachResolvedTargetPorts records the container port each named target port resolves to on the selected pods.
+func AttachResolvedTargetPorts(servicePorts []*ServicePort, pods []*Pod) {
+	for _, s := range servicePorts {
+		if s.TargetPortName == "" {
+			continue
+		}
+		for _, p := range pods {
+			if !s.selects(p.Namespace, p.Labels) {
+				continue
+			}
+			if port, ok := s.ResolveTargetPort(p); ok {
+				if s.ResolvedTargetPorts == nil {
+					s.ResolvedTargetPorts = make(map[string]int32)
+				}
+				s.ResolvedTargetPorts[p.Name] = port
+			}
+		}
+	}
+}
+
+func (co *KubernetesComponents) FindPodPortForHostname(s *ServicePort, hostname string) (podPorts []*PodPort, err error) {
+	servicePodPorts, err := co.FindPodPortForServicePort(s)
+	if err != nil {
+		return
+	}
+	for _, p := range servicePodPorts {
+		if p.Hostname == hostname && p.Subdomain == s.ServiceName {
+			podPorts = append(podPorts, p)
+		}
+	}
+	if len(podPorts) == 0 {
+		err = errors.New("could not find pod port matching the hostname and service subdomain")
+	}
+	return
+}
+
+func (co *KubernetesComponents) FindPodPortForIp(t *Target) (podPort *PodPort, err error) {
 	for _, p := range co.PodPorts {
-		if n == p.PodName {
+		if t.IpAddress.Equal(p.PodIP) && t.Namespace == p.Namespace && t.MatchesPort(p.ContainerPort, p.PortName) {
 			podPort = p
 			return
 		}
 	}
-	err = errors.New("could not find pod port matching the specified pod name")
+	err = errors.New("could not find pod port matching the pod ip address and port")
+	return
+}
+
+func (co *KubernetesComponents) FindPodPort(t *Target) (podPort *PodPort, err error) {
+	var podPorts []*PodPort
+	for _, p := range co.PodPorts {
+		if t.Name == p.PodName && (t.Namespace == "" || t.Namespace == p.Namespace) && t.MatchesPort(p.ContainerPort, p.PortName) {
+			podPorts = append(podPorts, p)
+		}
+	}
+	switch {
+	case len(podPorts) > 1:
+		err = errors.New("found more than one pod port matching the pod, specify the namespace as pod/name.namespace:port")
+	case len(podPorts) == 0:
+		err = errors.New("could not find pod port matching the specified pod name and port")
+	default:
+		podPort = podPorts[0]
+	}
 	return
 }
 
 func (co *KubernetesComponents) FindServicePortForPodPort(p *PodPort) (servicePort *ServicePort, err error) {
 	var servicePorts []*ServicePort
 	for _, s := range co.ServicePorts {
-		if p.Namespace == s.Namespace && p.App == s.AppSelector && (p.ContainerPort == s.TargetPort || p.PortName == s.TargetPortName) {
+		if s.SelectsPod(p) && s.TargetsPodPort(p) {
 			servicePorts = append(servicePorts, s)
 		}
 	}
@@ -165,33 +450,63 @@ func (co *KubernetesComponents) FindServicePortForPodPort(p *PodPort) (servicePo
 	return
 }
 
-func (co *KubernetesComponents) FindIngressPathForServicePort(s *ServicePort) (ingressPath *IngressPath, err error) {
-	var ingressPaths []*IngressPath
+func (co *KubernetesComponents) FindIngressPathForServicePort(s *ServicePort) (ingressPaths []*IngressPath, err error) {
 	for _, i := range co.IngressPaths {
-		if i.Namespace == s.Namespace && i.ServiceName == s.ServiceName && (i.ServiceIntPort == s.SourcePort || i.ServiceStrPort == s.SourcePortName) {
+		if i.TargetsServicePort(s) {
 			ingressPaths = append(ingressPaths, i)
 		}
 	}
-	switch {
-	case len(ingressPaths) > 1:
-		err = errors.New("found more than one ingress resource matching the service")
-	case len(ingressPaths) == 0:
+	if len(ingressPaths) == 0 {
 		err = errors.New("could not find ingress resource matching the service")
+	}
+	return
+}
+
+func (co *KubernetesComponents) FindServicePort(t *Target) (servicePort *ServicePort, err error) {
+	var servicePorts []*ServicePort
+	for _, s := range co.ServicePorts {
+		// Headless services resolve straight to pod IPs, so clients connect on the target port.
+		portMatch := t.MatchesPort(s.SourcePort, s.SourcePortName) || (s.Headless && t.MatchesPort(s.TargetPort, s.TargetPortName))
+		if t.Name == s.ServiceName && (t.Namespace == "" || t.Namespace == s.Namespace) && portMatch {
+			servicePorts = append(servicePorts, s)
+		}
+	}
+	switch {
+	case len(servicePorts) > 1:
+		err = errors.New("found more than one service port matching the service, specify the namespace as svc/name.namespace:port")
+	case len(servicePorts) == 0:
+		err = errors.New("could not find service port matching the specified service name and port")
 	default:
-		ingressPath = ingressPaths[0]
+		servicePort = servicePorts[0]
 	}
 	return
 }
 
 func (c *Client) GetComponents() (components *KubernetesComponents) {
 	pods := c.GetPods()
-	svcs := c.GetServices()
+	svcs, appProtocols := c.GetServices()
 	ings := c.GetIngresses()
+	networkPolicies, networkPolicyErr := c.GetNetworkPolicies()
+	namespaces, namespaceErr := c.GetNamespaces()
+	if networkPolicyErr == nil {
+		networkPolicyErr = namespaceErr
+	}
 	components = &KubernetesComponents{
-		IngressesToIngressPaths(ings),
-		ServicesToServicePorts(svcs),
-		PodsToPodPorts(pods),
+		IngressPaths:     append(IngressesToIngressPaths(ings), IngressRoutesToIngressPaths(c.GetIngressRoutes())...),
+		ServicePorts:     ServicesToServicePorts(svcs),
+		PodPorts:         PodsToPodPorts(pods),
+		Pods:             PodsToPods(pods),
+		NetworkPolicies:  networkPolicies.Items,
+		NamespaceLabels:  NamespacesToNamespaceLabels(namespaces),
+		Middlewares:      c.GetMiddlewares().Items,
+		NetworkPolicyErr: networkPolicyErr,
 	}
+	AttachIngressClassControllers(components.IngressPaths, c.GetIngressClasses())
+	components.AttachIngressRouteAddresses()
+	ResolveLoadBalancerHostnames(components.IngressPaths)
+	AttachServiceEndpoints(components.ServicePorts, c.GetServiceEndpoints())
+	AttachResolvedTargetPorts(components.ServicePorts, components.Pods)
+	AttachAppProtocols(components.ServicePorts, appProtocols)
 	return
 }
 
@@ -205,12 +520,10 @@ func (c *Client) GetPods() (apiPods *v1.PodList) {
 
 func PodsToPodPorts(apiPods *v1.PodList) (podPorts []*PodPort) {
 	for _, pod := range apiPods.Items {
+		ready, readyReason := podReadyCondition(&pod)
+		containers := podContainerHealth(&pod)
 		for _, container := range pod.Spec.Containers {
 			for _, port := range container.Ports {
-				appLabel, ok := pod.ObjectMeta.Labels["app"]
-				if !ok {
-					appLabel = ""
-				}
 				podPorts = append(
 					podPorts,
 					&PodPort{
@@ -223,8 +536,16 @@ func PodsToPodPorts(apiPods *v1.PodList) (podPorts []*PodPort) {
 						ContainerImage: container.Image,
 						PodName:        pod.ObjectMeta.Name,
 						Namespace:      pod.ObjectMeta.Namespace,
-						App:            appLabel,
+						PodIP:          net.ParseIP(pod.Status.PodIP),
+						Hostname:       pod.Spec.Hostname,
+						Subdomain:      pod.Spec.Subdomain,
+						NodeName:       pod.Spec.NodeName,
+						Labels:         pod.ObjectMeta.Labels,
 						PodStatus:      string(pod.Status.Phase),
+						Ready:          ready,
+						ReadyReason:    readyReason,
+						Containers:     containers,
+						Args:           append(append([]string{}, container.Command...), container.Args...),
 					},
 				)
 			}
@@ -233,10 +554,46 @@ func PodsToPodPorts(apiPods *v1.PodList) (podPorts []*PodPort) {
 	return
 }
 
-func (c *Client) GetServices() (apiServices *v1.ServiceList) {
-	apiServices, err := c.CoreV1().Services("").List(metav1.ListOptions{})
+func PodsToPods(apiPods *v1.PodList) (pods []*Pod) {
+	if apiPods == nil {
+		return
+	}
+	for _, pod := range apiPods.Items {
+		p := &Pod{
+			Name:        pod.ObjectMeta.Name,
+			Namespace:   pod.ObjectMeta.Namespace,
+			Labels:      pod.ObjectMeta.Labels,
+			PodStatus:   string(pod.Status.Phase),
+			PortNumbers: make(map[string]int32),
+			PodIP:       net.ParseIP(pod.Status.PodIP),
+		}
+		for _, container := range pod.Spec.Containers {
+			for _, port := range container.Ports {
+				if port.Name != "" {
+					p.PortNumbers[port.Name] = port.ContainerPort
+				}
+			}
+		}
+		pods = append(pods, p)
+	}
+	return
+}
+
+// GetServices lists the services once through the dynamic client, so the port appProtocol the pinned client-go
+// drops can be read from the same list.
+func (c *Client) GetServices() (apiServices *v1.ServiceList, appProtocols *ServiceAppProtocolList) {
+	apiServices = &v1.ServiceList{}
+	appProtocols = &ServiceAppProtocolList{}
+	unstructuredServices, err := c.Dynamic.Resource(v1.SchemeGroupVersion.WithResource("services")).List(metav1.ListOptions{})
 	if err != nil {
 		_ = level.Error(Logger).Log("msg", err)
+		return
+	}
+	for _, into := range []interface{}{apiServices, appProtocols} {
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredServices.UnstructuredContent(), into)
+		if err != nil {
+			_ = level.Error(Logger).Log("msg", err)
+		}
 	}
 	return
 }
@@ -249,13 +606,12 @@ func ServicesToServicePorts(apiServices *v1.ServiceList) (servicePorts []*Servic
 				hostName = ""
 			}
 			var ip net.IP
+			var externalHostname string
 			if len(service.Status.LoadBalancer.Ingress) > 0 {
 				ip = net.ParseIP(service.Status.LoadBalancer.Ingress[0].IP)
+				externalHostname = service.Status.LoadBalancer.Ingress[0].Hostname
 			}
-			appSelector, ok := service.Spec.Selector["app"]
-			if !ok {
-				appSelector = ""
-			}
+			sourceRanges, sourceRangesFrom := ServiceSourceRanges(service.Spec.LoadBalancerSourceRanges, service.ObjectMeta.Annotations)
 			var targetIntPort int32
 			if port.TargetPort.IntVal == 0 && port.TargetPort.StrVal == "" {
 				targetIntPort = port.Port
@@ -265,19 +621,25 @@ func ServicesToServicePorts(apiServices *v1.ServiceList) (servicePorts []*Servic
 			servicePorts = append(
 				servicePorts,
 				&ServicePort{
-					ServiceName:    service.ObjectMeta.Name,
-					AppSelector:    appSelector,
-					Type:           string(service.Spec.Type),
-					ClusterIP:      net.ParseIP(service.Spec.ClusterIP),
-					ExternalIP:     ip,
-					Host:           hostName,
-					Namespace:      service.ObjectMeta.Namespace,
-					Protocol:       string(port.Protocol),
-					SourcePortName: port.Name,
-					SourcePort:     port.Port,
-					NodePort:       port.NodePort,
-					TargetPort:     targetIntPort,
-					TargetPortName: port.TargetPort.StrVal,
+					ServiceName:           service.ObjectMeta.Name,
+					Selector:              service.Spec.Selector,
+					Type:                  string(service.Spec.Type),
+					ClusterIP:             net.ParseIP(service.Spec.ClusterIP),
+					Headless:              service.Spec.ClusterIP == v1.ClusterIPNone,
+					ExternalIP:            ip,
+					ExternalHostname:      externalHostname,
+					Host:                  hostName,
+					Namespace:             service.ObjectMeta.Namespace,
+					Protocol:              string(port.Protocol),
+					SourcePortName:        port.Name,
+					SourcePort:            port.Port,
+					NodePort:              port.NodePort,
+					TargetPort:            targetIntPort,
+					TargetPortName:        port.TargetPort.StrVal,
+					SourceRanges:          sourceRanges,
+					SourceRangesFrom:      sourceRangesFrom,
+					ExternalTrafficPolicy: string(service.Spec.ExternalTrafficPolicy),
+					Labels:                service.ObjectMeta.Labels,
 				},
 			)
 
@@ -287,29 +649,84 @@ func ServicesToServicePorts(apiServices *v1.ServiceList) (servicePorts []*Servic
 	return
 }
 
-func (c *Client) GetIngresses() (apiIngresses *v1beta1.IngressList) {
-	apiIngresses, err := c.ExtensionsV1beta1().Ingresses("").List(metav1.ListOptions{})
+func AttachAppProtocols(servicePorts []*ServicePort, apiServices *ServiceAppProtocolList) {
+	for _, service := range apiServices.Items {
+		for _, port := range service.Spec.Ports {
+			for _, s := range servicePorts {
+				if s.Namespace == service.ObjectMeta.Namespace && s.ServiceName == service.ObjectMeta.Name && s.SourcePortName == port.Name {
+					s.AppProtocol = port.AppProtocol
+				}
+			}
+		}
+	}
+}
+
+func (c *Client) GetIngresses() (apiIngresses *IngressList) {
+	apiIngresses = &IngressList{}
+	groupVersion, err := c.IngressGroupVersion()
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		return
+	}
+	apiIngresses.GroupVersion = groupVersion.String()
+	unstructuredIngresses, err := c.Dynamic.Resource(groupVersion.WithResource("ingresses")).List(metav1.ListOptions{})
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		return
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredIngresses.UnstructuredContent(), apiIngresses)
 	if err != nil {
 		_ = level.Error(Logger).Log("msg", err)
 	}
 	return
 }
 
-func IngressesToIngressPaths(apiIngresses *v1beta1.IngressList) (ingressPaths []*IngressPath) {
+func IngressesToIngressPaths(apiIngresses *IngressList) (ingressPaths []*IngressPath) {
 	for _, ingressResource := range apiIngresses.Items {
+		ipAddresses, lbHostnames := ingressResource.LoadBalancerAddresses()
+		if backend := ingressResource.DefaultBackend(); backend != nil {
+			serviceName, servicePort := backend.ServiceBackend()
+			ingressPaths = append(
+				ingressPaths,
+				&IngressPath{
+					DefaultBackend:        true,
+					IngressClassName:      ingressResource.ClassName(),
+					Annotations:           ingressResource.ObjectMeta.Annotations,
+					ServiceName:           serviceName,
+					ServiceIntPort:        servicePort.IntVal,
+					ServiceStrPort:        servicePort.StrVal,
+					IngressName:           ingressResource.ObjectMeta.Name,
+					IpAddresses:           ipAddresses,
+					LoadBalancerHostnames: lbHostnames,
+					Namespace:             ingressResource.ObjectMeta.Namespace,
+				},
+			)
+		}
 		for _, ingress := range ingressResource.Spec.Rules {
-			for _, path := range ingress.IngressRuleValue.HTTP.Paths {
+			if ingress.HTTP == nil {
+				continue
+			}
+			for _, path := range ingress.HTTP.Paths {
+				serviceName, servicePort := path.Backend.ServiceBackend()
+				var pathType string
+				if path.PathType != nil {
+					pathType = *path.PathType
+				}
 				ingressPaths = append(
 					ingressPaths,
 					&IngressPath{
-						Path:           path.Path,
-						ServiceName:    path.Backend.ServiceName,
-						ServiceIntPort: path.Backend.ServicePort.IntVal,
-						ServiceStrPort: path.Backend.ServicePort.StrVal,
-						IngressName:    ingressResource.ObjectMeta.Name,
-						IpAddress:      net.ParseIP(ingressResource.Status.LoadBalancer.Ingress[0].IP),
-						Namespace:      ingressResource.ObjectMeta.Namespace,
-						Host:           ingress.Host,
+						Path:                  path.Path,
+						PathType:              pathType,
+						IngressClassName:      ingressResource.ClassName(),
+						Annotations:           ingressResource.ObjectMeta.Annotations,
+						ServiceName:           serviceName,
+						ServiceIntPort:        servicePort.IntVal,
+						ServiceStrPort:        servicePort.StrVal,
+						IngressName:           ingressResource.ObjectMeta.Name,
+						IpAddresses:           ipAddresses,
+						LoadBalancerHostnames: lbHostnames,
+						Namespace:             ingressResource.ObjectMeta.Namespace,
+						Host:                  ingress.Host,
 					},
 				)
 			}
@@ -318,54 +735,21 @@ func IngressesToIngressPaths(apiIngresses *v1beta1.IngressList) (ingressPaths []
 	return
 }
 
-func (c *Client) IsPodListening(p *PodPort) (result bool) {
-	roundTripper, upgrader, err := spdy.RoundTripperFor(c.Config)
+// IsPodListening port-forwards to the pod and runs the probe against the forwarded port.
+func (c *Client) IsPodListening(p *PodPort, probe *PortProbe) (result string, listening bool) {
+	forward, err := c.ForwardPort(p, portForwardTimeout)
 	if err != nil {
 		_ = level.Error(Logger).Log("msg", err)
+		result = err.Error()
 		return
 	}
-	path := fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/portforward", p.Namespace, p.PodName)
-	hostIP := strings.TrimLeft(c.Config.Host, "htps:/")
-	serverURL := url.URL{Scheme: "https", Path: path, Host: hostIP}
-	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, &serverURL)
-	stopChan, readyChan := make(chan struct{}, 1), make(chan struct{}, 1)
-	out, errOut := new(bytes.Buffer), new(bytes.Buffer)
-	forwarder, err := portforward.New(dialer, []string{fmt.Sprintf("%v", p.ContainerPort)}, stopChan, readyChan, out, errOut)
+	defer forward.Close()
+	result, err = probe.Run(forward.LocalAddress)
 	if err != nil {
 		_ = level.Error(Logger).Log("msg", err)
+		result = err.Error()
 		return
 	}
-	wait := sync.WaitGroup{}
-	wait.Add(1)
-	go func() {
-		go func() {
-			for range readyChan {
-			}
-			if len(errOut.String()) != 0 {
-				_ = level.Error(Logger).Log("msg", errOut.String())
-				fmt.Println(errOut.String())
-				wait.Done()
-				return
-			} else if len(out.String()) != 0 {
-				fmt.Println(out.String())
-			}
-			wait.Done()
-		}()
-		if err = forwarder.ForwardPorts(); err != nil {
-			_ = level.Error(Logger).Log("msg", err)
-			wait.Done()
-			return
-		}
-	}()
-	wait.Wait()
-	pfUrl := fmt.Sprintf("http://127.0.0.1:%v", p.ContainerPort)
-	_, err = http.Get(pfUrl)
-	close(stopChan)
-	if err != nil {
-		_ = level.Error(Logger).Log("msg", err)
-		result = false
-	} else {
-		result = true
-	}
+	listening = true
 	return
 }
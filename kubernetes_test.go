@@ -3,12 +3,204 @@ package netkat_test
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
 )
 
+type (
+	PathMatchTest struct {
+		IngressPath netkat.IngressPath
+		Path        string
+		Expected    bool
+	}
+
+	HostMatchTest struct {
+		RuleHost string
+		Host     string
+		Expected bool
+	}
+
+	SelectorTest struct {
+		Selector map[string]string
+		Labels   map[string]string
+		Expected bool
+	}
+)
+
+var (
+	nginxRegex = map[string]string{"nginx.ingress.kubernetes.io/use-regex": "true"}
+	lbAddress  = []net.IP{net.ParseIP("10.0.0.1")}
+
+	PathMatchTests = []PathMatchTest{
+		{netkat.IngressPath{Path: "/api", PathType: "Prefix"}, "/api/users", true},
+		{netkat.IngressPath{Path: "/api/", PathType: "Prefix"}, "/api", true},
+		{netkat.IngressPath{Path: "/api", PathType: "Prefix"}, "/apis", false},
+		{netkat.IngressPath{Path: "/", PathType: "Prefix"}, "/anything", true},
+		{netkat.IngressPath{Path: "/api", PathType: "Exact"}, "/api", true},
+		{netkat.IngressPath{Path: "/api", PathType: "Exact"}, "/api/", false},
+		{netkat.IngressPath{Path: "/api", PathType: "ImplementationSpecific", IngressClassName: "nginx"}, "/apis", true},
+		{netkat.IngressPath{Path: "/api/v[0-9]+/", PathType: "ImplementationSpecific", IngressClassName: "nginx", Annotations: nginxRegex}, "/API/v2/users", true},
+		{netkat.IngressPath{Path: "/api/v[0-9]+/", PathType: "ImplementationSpecific", IngressClassName: "nginx", Annotations: nginxRegex}, "/api/vx/users", false},
+		{netkat.IngressPath{Path: "/api", PathType: "ImplementationSpecific", IngressClassName: "public", IngressClassController: "k8s.io/ingress-nginx"}, "/apis", true},
+		{netkat.IngressPath{Path: "/api", PathType: "ImplementationSpecific", IngressClassController: "k8s.io/ingress-nginx"}, "/apis", true},
+		{netkat.IngressPath{Path: "/api", PathType: "ImplementationSpecific", IngressClassName: "public"}, "/apis", false},
+		{netkat.IngressPath{Path: "/static/*", IngressClassName: "gce"}, "/static/app.js", true},
+		{netkat.IngressPath{Path: "/static", IngressClassName: "gce"}, "/static/app.js", false},
+	}
+
+	HostMatchTests = []HostMatchTest{
+		{"foo.example.com", "foo.example.com", true},
+		{"foo.example.com", "bar.example.com", false},
+		{"*.example.com", "foo.example.com", true},
+		{"*.example.com", "Foo.Example.com", true},
+		{"*.example.com", "foo.bar.example.com", false},
+		{"*.example.com", "example.com", false},
+		{"", "anything.example.com", true},
+	}
+
+	SelectorTests = []SelectorTest{
+		{map[string]string{"app": "web"}, map[string]string{"app": "web", "pod-template-hash": "abc"}, true},
+		{map[string]string{"app.kubernetes.io/name": "web"}, map[string]string{"app.kubernetes.io/name": "web"}, true},
+		{map[string]string{"app": "web", "component": "api"}, map[string]string{"app": "web", "component": "api"}, true},
+		{map[string]string{"app": "web", "component": "api"}, map[string]string{"app": "web", "component": "worker"}, false},
+		{map[string]string{"app": "web", "component": "api"}, map[string]string{"app": "web"}, false},
+		{map[string]string{}, map[string]string{"app": "web"}, false},
+	}
+)
+
+const IngressListJson = `{"items": [
+  {"metadata": {"name": "v1-ingress", "namespace": "default"},
+   "spec": {"ingressClassName": "nginx", "rules": [{"host": "hello-world.info", "http": {"paths": [
+     {"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "web", "port": {"number": 8080}}}},
+     {"path": "/api", "pathType": "Exact", "backend": {"service": {"name": "api", "port": {"name": "http"}}}}
+   ]}}]},
+   "status": {"loadBalancer": {"ingress": [{"ip": "10.0.0.1"}]}}},
+  {"metadata": {"name": "v1beta1-ingress", "namespace": "default", "annotations": {"kubernetes.io/ingress.class": "traefik"}},
+   "spec": {"rules": [{"host": "legacy.info", "http": {"paths": [
+     {"path": "/", "backend": {"serviceName": "legacy", "servicePort": 80}}
+   ]}}]},
+   "status": {"loadBalancer": {"ingress": [{"hostname": "abc123.eu-west-1.elb.amazonaws.com"}, {"ip": "10.0.0.2"}]}}},
+  {"metadata": {"name": "pending-ingress", "namespace": "default"},
+   "spec": {"rules": [{"host": "pending.info", "http": {"paths": [
+     {"path": "/", "pathType": "Prefix", "backend": {"service": {"name": "pending", "port": {"number": 80}}}}
+   ]}}]}}
+]}`
+
+func (s *StoreSuite) TestMatchPath() {
+	for _, test := range PathMatchTests {
+		matched, _ := test.IngressPath.MatchPath(test.Path)
+		assert.Equal(s.T(), test.Expected, matched, test.IngressPath.Path, test.Path)
+	}
+}
+
+func (s *StoreSuite) TestFindIngressPathForHost() {
+	components := netkat.KubernetesComponents{
+		IngressPaths: []*netkat.IngressPath{
+			{IngressName: "root", Host: "hello-world.info", Path: "/", PathType: "Prefix", IpAddresses: lbAddress},
+			{IngressName: "api", Host: "hello-world.info", Path: "/api", PathType: "Prefix", IpAddresses: lbAddress},
+			{IngressName: "api-exact", Host: "hello-world.info", Path: "/api/users/me", PathType: "Exact", IpAddresses: lbAddress},
+			{IngressName: "pending", Host: "hello-world.info", Path: "/api/users", PathType: "Prefix"},
+		},
+	}
+	target := netkat.Target{Host: "hello-world.info", Path: "/api/users", IpAddress: lbAddress[0]}
+	ingressPath, err := components.FindIngressPathForHost(&target)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.Equal(s.T(), "api", ingressPath.IngressName, "Expected the longest matching prefix to win")
+	matches := components.MatchIngressPaths(&target)
+	assert.Equal(s.T(), 3, len(matches))
+	assert.False(s.T(), matches[2].Matched)
+
+	// A trailing slash doesn't make a Prefix path longer, so the Exact path of the same length wins.
+	components.IngressPaths = append(components.IngressPaths,
+		&netkat.IngressPath{IngressName: "users", Host: "hello-world.info", Path: "/api/users/", PathType: "Prefix", IpAddresses: lbAddress},
+		&netkat.IngressPath{IngressName: "users-exact", Host: "hello-world.info", Path: "/api/users", PathType: "Exact", IpAddresses: lbAddress},
+	)
+	ingressPath, err = components.FindIngressPathForHost(&target)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.Equal(s.T(), "users-exact", ingressPath.IngressName)
+}
+
+func (s *StoreSuite) TestMatchHost() {
+	for _, test := range HostMatchTests {
+		ingressPath := netkat.IngressPath{Host: test.RuleHost}
+		matched, _ := ingressPath.MatchHost(test.Host)
+		assert.Equal(s.T(), test.Expected, matched, test.RuleHost, test.Host)
+	}
+}
+
+func (s *StoreSuite) TestFindIngressPathForHostWildcardAndDefaultBackend() {
+	components := netkat.KubernetesComponents{
+		IngressPaths: []*netkat.IngressPath{
+			{IngressName: "wildcard", Host: "*.example.com", Path: "/", PathType: "Prefix", IpAddresses: lbAddress},
+			{IngressName: "exact", Host: "foo.example.com", Path: "/api", PathType: "Prefix", IpAddresses: lbAddress},
+			{IngressName: "exact", DefaultBackend: true, ServiceName: "fallback", IpAddresses: lbAddress},
+		},
+	}
+	ingressPath, err := components.FindIngressPathForHost(&netkat.Target{Host: "bar.example.com", Path: "/", IpAddress: lbAddress[0]})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.Equal(s.T(), "wildcard", ingressPath.IngressName)
+	ingressPath, err = components.FindIngressPathForHost(&netkat.Target{Host: "foo.example.com", Path: "/other", IpAddress: lbAddress[0]})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.True(s.T(), ingressPath.DefaultBackend, "Expected the exact host to fall back to its default backend")
+	assert.Equal(s.T(), "fallback", ingressPath.ServiceName)
+}
+
+func (s *StoreSuite) TestSelectsPod() {
+	for _, test := range SelectorTests {
+		servicePort := netkat.ServicePort{Namespace: "default", Selector: test.Selector}
+		podPort := netkat.PodPort{Namespace: "default", Labels: test.Labels}
+		assert.Equal(s.T(), test.Expected, servicePort.SelectsPod(&podPort), test.Selector, test.Labels)
+	}
+	servicePort := netkat.ServicePort{Namespace: "default", Selector: map[string]string{"app": "web"}}
+	podPort := netkat.PodPort{Namespace: "other", Labels: map[string]string{"app": "web"}}
+	assert.False(s.T(), servicePort.SelectsPod(&podPort), "Expected services not to select pods in other namespaces")
+}
+
+func (s *StoreSuite) TestNamedTargetPort() {
+	web := map[string]string{"app": "web"}
+	components := netkat.KubernetesComponents{
+		PodPorts: []*netkat.PodPort{
+			{PodName: "web-v1", Namespace: "default", Labels: web, PortName: "http", ContainerPort: 8080},
+			{PodName: "web-v2", Namespace: "default", Labels: web, PortName: "http", ContainerPort: 9090},
+			{PodName: "web-v2", Namespace: "default", Labels: web, PortName: "metrics", ContainerPort: 8080},
+			{PodName: "web-broken", Namespace: "default", Labels: web, PortName: "web", ContainerPort: 8080},
+		},
+	}
+	servicePort := netkat.ServicePort{ServiceName: "web", Namespace: "default", Selector: web, SourcePort: 80, TargetPortName: "http"}
+	podPorts, err := components.FindPodPortForServicePort(&servicePort)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.Equal(s.T(), 2, len(podPorts))
+	for _, p := range podPorts {
+		assert.Equal(s.T(), "http", p.PortName, p.PodName)
+	}
+	components.Pods = []*netkat.Pod{
+		{Name: "web-v1", Namespace: "default", Labels: web, PortNumbers: map[string]int32{"http": 8080}},
+		{Name: "web-v2", Namespace: "default", Labels: web, PortNumbers: map[string]int32{"http": 9090, "metrics": 8080}},
+		{Name: "web-broken", Namespace: "default", Labels: web, PortNumbers: map[string]int32{"web": 8080}},
+		{Name: "web-no-ports", Namespace: "default", Labels: web},
+	}
+	assert.Equal(s.T(), []string{"web-broken", "web-no-ports"}, components.FindPodsMissingTargetPort(&servicePort))
+	netkat.AttachResolvedTargetPorts([]*netkat.ServicePort{&servicePort}, components.Pods)
+	assert.Equal(s.T(), map[string]int32{"web-v1": 8080, "web-v2": 9090}, servicePort.ResolvedTargetPorts)
+	numbered := netkat.ServicePort{ServiceName: "web", Namespace: "default", Selector: web, SourcePort: 80, TargetPort: 8080}
+	assert.Empty(s.T(), components.FindPodsMissingTargetPort(&numbered))
+}
+
 func (s *StoreSuite) TestGets() {
 	pods := s.client.GetPods()
-	services := s.client.GetServices()
+	services, _ := s.client.GetServices()
 	ingresses := s.client.GetIngresses()
 	po, err := json.Marshal(pods)
 	if err != nil {
@@ -33,10 +225,51 @@ func (s *StoreSuite) TestGetServices() {
 }
 
 func (s *StoreSuite) TestGetIngress() {
-	_, err := s.client.ExtensionsV1beta1().Ingresses("").List(v1.ListOptions{})
+	groupVersion, err := s.client.IngressGroupVersion()
 	if err != nil {
 		s.T().Fatal(err)
 	}
+	_, err = s.client.Dynamic.Resource(groupVersion.WithResource("ingresses")).List(v1.ListOptions{})
+	if err != nil {
+		s.T().Fatal(err)
+	}
+}
+
+func (s *StoreSuite) TestIngressesToIngressPaths() {
+	var ingressList netkat.IngressList
+	err := json.Unmarshal([]byte(IngressListJson), &ingressList)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	ingressPaths := netkat.IngressesToIngressPaths(&ingressList)
+	assert.Equal(s.T(), 4, len(ingressPaths))
+	assert.Equal(s.T(), "Prefix", ingressPaths[0].PathType)
+	assert.Equal(s.T(), "nginx", ingressPaths[0].IngressClassName)
+	assert.Equal(s.T(), "web", ingressPaths[0].ServiceName)
+	assert.Equal(s.T(), int32(8080), ingressPaths[0].ServiceIntPort)
+	assert.Equal(s.T(), "http", ingressPaths[1].ServiceStrPort)
+	assert.Equal(s.T(), "traefik", ingressPaths[2].IngressClassName)
+	assert.Equal(s.T(), "legacy", ingressPaths[2].ServiceName)
+	assert.Equal(s.T(), int32(80), ingressPaths[2].ServiceIntPort)
+	assert.Equal(s.T(), []string{"abc123.eu-west-1.elb.amazonaws.com"}, ingressPaths[2].LoadBalancerHostnames)
+	assert.True(s.T(), ingressPaths[2].HasAddress(net.ParseIP("10.0.0.2")))
+	assert.Empty(s.T(), ingressPaths[3].IpAddresses, "Expected a pending ingress to have no addresses")
+}
+
+func (s *StoreSuite) TestResolveLoadBalancerHostnames() {
+	shared := make([]net.IP, 1, 4)
+	shared[0] = net.ParseIP("10.0.0.1")
+	ingressPaths := []*netkat.IngressPath{
+		{IngressName: "a", IpAddresses: shared, LoadBalancerHostnames: []string{"10.0.0.8"}},
+		{IngressName: "b", IpAddresses: shared, LoadBalancerHostnames: []string{"10.0.0.9"}},
+		{IngressName: "pending"},
+	}
+	netkat.ResolveLoadBalancerHostnames(ingressPaths)
+	assert.True(s.T(), ingressPaths[0].HasAddress(net.ParseIP("10.0.0.8")))
+	assert.False(s.T(), ingressPaths[0].HasAddress(net.ParseIP("10.0.0.9")), "Expected paths sharing addresses not to overwrite each other")
+	assert.True(s.T(), ingressPaths[1].HasAddress(net.ParseIP("10.0.0.9")))
+	assert.Equal(s.T(), 1, len(shared))
+	assert.Empty(s.T(), ingressPaths[2].IpAddresses)
 }
 
 func (s *StoreSuite) TestGetPods() {
@@ -0,0 +1,362 @@
+package netkat
+
+import (
+	"fmt"
+	"github.com/go-kit/kit/log/level"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"net"
+	"strings"
+)
+
+// The network policy types below mirror networking.k8s.io/v1 NetworkPolicy, including endPort which the
+// pinned client-go drops.
+type (
+	NetworkPolicy struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		Spec              NetworkPolicySpec `json:"spec,omitempty"`
+	}
+
+	NetworkPolicyList struct {
+		Items []NetworkPolicy `json:"items"`
+	}
+
+	NetworkPolicySpec struct {
+		PodSelector metav1.LabelSelector       `json:"podSelector"`
+		Ingress     []NetworkPolicyIngressRule `json:"ingress,omitempty"`
+		Egress      []NetworkPolicyEgressRule  `json:"egress,omitempty"`
+		PolicyTypes []string                   `json:"policyTypes,omitempty"`
+	}
+
+	NetworkPolicyIngressRule struct {
+		Ports []NetworkPolicyPort `json:"ports,omitempty"`
+		From  []NetworkPolicyPeer `json:"from,omitempty"`
+	}
+
+	NetworkPolicyEgressRule struct {
+		Ports []NetworkPolicyPort `json:"ports,omitempty"`
+		To    []NetworkPolicyPeer `json:"to,omitempty"`
+	}
+
+	NetworkPolicyPort struct {
+		Protocol *string             `json:"protocol,omitempty"`
+		Port     *intstr.IntOrString `json:"port,omitempty"`
+		EndPort  *int32              `json:"endPort,omitempty"`
+	}
+
+	NetworkPolicyPeer struct {
+		PodSelector       *metav1.LabelSelector `json:"podSelector,omitempty"`
+		NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+		IPBlock           *IPBlock              `json:"ipBlock,omitempty"`
+	}
+
+	IPBlock struct {
+		CIDR   string   `json:"cidr"`
+		Except []string `json:"except,omitempty"`
+	}
+
+	// TrafficSource is where evaluated traffic comes from. Namespace sources stand for a pod in the namespace
+	// without labels, so only policies selecting every pod in the namespace match them.
+	TrafficSource struct {
+		Description string
+		Namespace   string
+		Labels      map[string]string
+		IpAddress   net.IP
+		Cidr        *net.IPNet
+	}
+
+	// PolicyVerdict explains whether traffic from a source reaches a pod port, naming the policies and rules
+	// that decided it.
+	PolicyVerdict struct {
+		Source  *TrafficSource
+		PodPort *PodPort
+		Allowed bool
+		Reasons []string
+	}
+)
+
+const (
+	PolicyTypeIngress = "Ingress"
+	PolicyTypeEgress  = "Egress"
+
+	namespaceNameLabel = "kubernetes.io/metadata.name"
+)
+
+var (
+	networkPolicyGroupVersion = schema.GroupVersion{Group: "networking.k8s.io", Version: "v1"}
+	// ingressControllerLabels identify the pods of common ingress controllers.
+	ingressControllerLabels = map[string][]map[string]string{
+		IngressControllerNginx: {
+			{"app.kubernetes.io/name": "ingress-nginx"},
+			{"app": "ingress-nginx"},
+			{"app": "nginx-ingress"},
+		},
+		IngressControllerTraefik: {
+			{"app.kubernetes.io/name": "traefik"},
+			{"app": "traefik"},
+		},
+	}
+)
+
+// GetNetworkPolicies returns the error with the list, as without every policy no traffic can be judged allowed.
+func (c *Client) GetNetworkPolicies() (apiNetworkPolicies *NetworkPolicyList, err error) {
+	apiNetworkPolicies = &NetworkPolicyList{}
+	unstructuredPolicies, err := c.Dynamic.Resource(networkPolicyGroupVersion.WithResource("networkpolicies")).List(metav1.ListOptions{})
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		return
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredPolicies.UnstructuredContent(), apiNetworkPolicies)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+	}
+	return
+}
+
+// GetNamespaces returns the error with the list, as namespace selectors can't be evaluated without the labels.
+func (c *Client) GetNamespaces() (apiNamespaces *v1.NamespaceList, err error) {
+	apiNamespaces, err = c.CoreV1().Namespaces().List(metav1.ListOptions{})
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+	}
+	return
+}
+
+// NamespacesToNamespaceLabels maps each namespace to its labels, adding the kubernetes.io/metadata.name label
+// that clusters before 1.21 don't set.
+func NamespacesToNamespaceLabels(apiNamespaces *v1.NamespaceList) (namespaceLabels map[string]map[string]string) {
+	namespaceLabels = make(map[string]map[string]string)
+	if apiNamespaces == nil {
+		return
+	}
+	for _, namespace := range apiNamespaces.Items {
+		namespaceLabels[namespace.Name] = map[string]string{namespaceNameLabel: namespace.Name}
+		for k, v := range namespace.Labels {
+			namespaceLabels[namespace.Name][k] = v
+		}
+	}
+	return
+}
+
+// PodTrafficSource describes traffic coming from the pod.
+func PodTrafficSource(pod *v1.Pod) *TrafficSource {
+	return &TrafficSource{
+		Description: fmt.Sprintf("pod %s/%s", pod.Namespace, pod.Name),
+		Namespace:   pod.Namespace,
+		Labels:      pod.Labels,
+		IpAddress:   net.ParseIP(pod.Status.PodIP),
+	}
+}
+
+// FindIngressControllerPods finds the pods of the controller serving the ingress path as traffic sources.
+func (co *KubernetesComponents) FindIngressControllerPods(i *IngressPath) (sources []*TrafficSource) {
+	for _, p := range uniquePods(co.FindIngressPathControllerPodPorts(i)) {
+		sources = append(sources, &TrafficSource{
+			Description: fmt.Sprintf("ingress controller pod %s", p.key()),
+			Namespace:   p.Namespace,
+			Labels:      p.Labels,
+			IpAddress:   p.PodIP,
+		})
+	}
+	return
+}
+
+// FindIngressControllerPodPorts finds the pod ports of the controller's pods.
+func (co *KubernetesComponents) FindIngressControllerPodPorts(controller string) (podPorts []*PodPort) {
+	for _, p := range co.PodPorts {
+		for _, selector := range ingressControllerLabels[controller] {
+			if selectorMatches(&metav1.LabelSelector{MatchLabels: selector}, p.Labels) {
+				podPorts = append(podPorts, p)
+				break
+			}
+		}
+	}
+	return
+}
+
+// EvaluateNetworkPolicies decides whether traffic from the source reaches the pod port. Traffic must be allowed
+// both by the egress policies selecting an in-cluster source and by the ingress policies selecting the pod.
+// Pods no policy of a direction selects are not isolated in that direction.
+func (co *KubernetesComponents) EvaluateNetworkPolicies(source *TrafficSource, p *PodPort) (verdict *PolicyVerdict) {
+	verdict = &PolicyVerdict{Source: source, PodPort: p, Allowed: true}
+	if source.Namespace != "" {
+		allowed, reasons := co.evaluateEgress(source, p)
+		verdict.Allowed = verdict.Allowed && allowed
+		verdict.Reasons = append(verdict.Reasons, reasons...)
+	}
+	allowed, reasons := co.evaluateIngress(source, p)
+	verdict.Allowed = verdict.Allowed && allowed
+	verdict.Reasons = append(verdict.Reasons, reasons...)
+	return
+}
+
+func (co *KubernetesComponents) evaluateIngress(source *TrafficSource, p *PodPort) (allowed bool, reasons []string) {
+	var isolating []string
+	for _, policy := range co.NetworkPolicies {
+		if policy.Namespace != p.Namespace || !policy.HasType(PolicyTypeIngress) || !selectorMatches(&policy.Spec.PodSelector, p.Labels) {
+			continue
+		}
+		isolating = append(isolating, policy.Namespace+"/"+policy.Name)
+		for n, rule := range policy.Spec.Ingress {
+			if co.peersMatch(rule.From, policy.Namespace, source.Namespace, source.Labels, source.IpAddress, source.Cidr) && portsMatch(rule.Ports, p) {
+				allowed = true
+				reasons = append(reasons, fmt.Sprintf("ingress allowed by networkpolicy %s/%s rule %d", policy.Namespace, policy.Name, n))
+			}
+		}
+	}
+	if len(isolating) == 0 {
+		return true, []string{fmt.Sprintf("ingress allowed, no networkpolicy selects pod %s", p.PodName)}
+	}
+	if !allowed {
+		reasons = append(reasons, fmt.Sprintf("ingress denied, pod %s is selected by networkpolicy %s and no ingress rule matches", p.PodName, strings.Join(isolating, ", ")))
+	}
+	return
+}
+
+func (co *KubernetesComponents) evaluateEgress(source *TrafficSource, p *PodPort) (allowed bool, reasons []string) {
+	var isolating []string
+	for _, policy := range co.NetworkPolicies {
+		if policy.Namespace != source.Namespace || !policy.HasType(PolicyTypeEgress) || !selectorMatches(&policy.Spec.PodSelector, source.Labels) {
+			continue
+		}
+		isolating = append(isolating, policy.Namespace+"/"+policy.Name)
+		for n, rule := range policy.Spec.Egress {
+			if co.peersMatch(rule.To, policy.Namespace, p.Namespace, p.Labels, p.PodIP, nil) && portsMatch(rule.Ports, p) {
+				allowed = true
+				reasons = append(reasons, fmt.Sprintf("egress allowed by networkpolicy %s/%s rule %d", policy.Namespace, policy.Name, n))
+			}
+		}
+	}
+	if len(isolating) == 0 {
+		return true, []string{fmt.Sprintf("egress allowed, no networkpolicy selects %s", source.Description)}
+	}
+	if !allowed {
+		reasons = append(reasons, fmt.Sprintf("egress denied, %s is selected by networkpolicy %s and no egress rule matches", source.Description, strings.Join(isolating, ", ")))
+	}
+	return
+}
+
+// HasType applies the policyTypes defaults: Ingress always, and Egress when the policy has egress rules.
+func (np *NetworkPolicy) HasType(policyType string) bool {
+	if len(np.Spec.PolicyTypes) == 0 {
+		return policyType == PolicyTypeIngress || (policyType == PolicyTypeEgress && len(np.Spec.Egress) > 0)
+	}
+	for _, t := range np.Spec.PolicyTypes {
+		if t == policyType {
+			return true
+		}
+	}
+	return false
+}
+
+// peersMatch reports whether a rule's peers include the peer. A rule without peers matches everything, pod and
+// namespace selectors only match in-cluster peers, and ipBlocks only match peers with a known address.
+func (co *KubernetesComponents) peersMatch(peers []NetworkPolicyPeer, policyNamespace string, namespace string, podLabels map[string]string, ip net.IP, cidr *net.IPNet) bool {
+	if len(peers) == 0 {
+		return true
+	}
+	for _, peer := range peers {
+		switch {
+		case peer.IPBlock != nil:
+			if ipBlockContains(peer.IPBlock, ip, cidr) {
+				return true
+			}
+		case namespace == "":
+			continue
+		case peer.NamespaceSelector != nil:
+			namespaceMatch := selectorMatches(peer.NamespaceSelector, co.NamespaceLabels[namespace])
+			podMatch := peer.PodSelector == nil || selectorMatches(peer.PodSelector, podLabels)
+			if namespaceMatch && podMatch {
+				return true
+			}
+		case peer.PodSelector != nil:
+			if namespace == policyNamespace && selectorMatches(peer.PodSelector, podLabels) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func portsMatch(ports []NetworkPolicyPort, p *PodPort) bool {
+	if len(ports) == 0 {
+		return true
+	}
+	podProtocol := p.Protocol
+	if podProtocol == "" {
+		podProtocol = string(v1.ProtocolTCP)
+	}
+	for _, port := range ports {
+		protocol := string(v1.ProtocolTCP)
+		if port.Protocol != nil {
+			protocol = *port.Protocol
+		}
+		if protocol != podProtocol {
+			continue
+		}
+		switch {
+		case port.Port == nil:
+			return true
+		case port.Port.Type == intstr.String:
+			if port.Port.StrVal == p.PortName {
+				return true
+			}
+		case port.EndPort != nil:
+			if p.ContainerPort >= port.Port.IntVal && p.ContainerPort <= *port.EndPort {
+				return true
+			}
+		case port.Port.IntVal == p.ContainerPort:
+			return true
+		}
+	}
+	return false
+}
+
+// ipBlockContains reports whether the address, or every address in the cidr, is in the block and outside its
+// exceptions.
+func ipBlockContains(block *IPBlock, ip net.IP, cidr *net.IPNet) bool {
+	_, blockNet, err := net.ParseCIDR(block.CIDR)
+	if err != nil {
+		return false
+	}
+	if cidr != nil {
+		if !blockNet.Contains(cidr.IP) || !blockNet.Contains(lastAddress(cidr)) {
+			return false
+		}
+	} else if ip == nil || !blockNet.Contains(ip) {
+		return false
+	}
+	for _, except := range block.Except {
+		_, exceptNet, err := net.ParseCIDR(except)
+		if err != nil {
+			continue
+		}
+		if cidr != nil && (exceptNet.Contains(cidr.IP) || cidr.Contains(exceptNet.IP)) {
+			return false
+		}
+		if cidr == nil && exceptNet.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func lastAddress(cidr *net.IPNet) net.IP {
+	last := make(net.IP, len(cidr.IP))
+	for i := range cidr.IP {
+		last[i] = cidr.IP[i] | ^cidr.Mask[i]
+	}
+	return last
+}
+
+func selectorMatches(selector *metav1.LabelSelector, podLabels map[string]string) bool {
+	parsed, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false
+	}
+	return parsed.Matches(labels.Set(podLabels))
+}
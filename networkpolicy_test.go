@@ -0,0 +1,158 @@
+package netkat_test
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+	"net"
+)
+
+type (
+	NetworkPolicyTest struct {
+		Source  netkat.TrafficSource
+		PodPort netkat.PodPort
+		Allowed bool
+		Reason  string
+	}
+)
+
+const NetworkPolicyListJson = `{"items": [
+  {"metadata": {"name": "default-deny", "namespace": "shop"},
+   "spec": {"podSelector": {}, "policyTypes": ["Ingress"]}},
+  {"metadata": {"name": "allow-frontend", "namespace": "shop"},
+   "spec": {"podSelector": {"matchLabels": {"app": "api"}},
+            "ingress": [{"from": [{"podSelector": {"matchLabels": {"app": "frontend"}}}], "ports": [{"port": "http"}]}]}},
+  {"metadata": {"name": "allow-ingress-nginx", "namespace": "shop"},
+   "spec": {"podSelector": {"matchLabels": {"app": "web"}},
+            "ingress": [{"from": [{"namespaceSelector": {"matchLabels": {"kubernetes.io/metadata.name": "ingress-nginx"}}}]}]}},
+  {"metadata": {"name": "allow-office", "namespace": "shop"},
+   "spec": {"podSelector": {"matchLabels": {"app": "web"}},
+            "ingress": [{"from": [{"ipBlock": {"cidr": "203.0.113.0/24", "except": ["203.0.113.128/25"]}}], "ports": [{"port": 8000, "endPort": 8100}]}]}},
+  {"metadata": {"name": "restrict-egress", "namespace": "batch"},
+   "spec": {"podSelector": {"matchLabels": {"app": "job"}}, "policyTypes": ["Egress"],
+            "egress": [{"to": [{"namespaceSelector": {"matchLabels": {"team": "data"}}}]}]}}
+]}`
+
+var (
+	api      = netkat.PodPort{PodName: "api-0", Namespace: "shop", Labels: map[string]string{"app": "api"}, PortName: "http", ContainerPort: 8080}
+	web      = netkat.PodPort{PodName: "web-0", Namespace: "shop", Labels: map[string]string{"app": "web"}, ContainerPort: 8080}
+	frontend = netkat.TrafficSource{Description: "pod shop/frontend-0", Namespace: "shop", Labels: map[string]string{"app": "frontend"}}
+	job      = netkat.TrafficSource{Description: "pod batch/job-0", Namespace: "batch", Labels: map[string]string{"app": "job"}}
+
+	NetworkPolicyTests = []NetworkPolicyTest{
+		{frontend, api, true, "ingress allowed by networkpolicy shop/allow-frontend rule 0"},
+		{frontend, web, false, "ingress denied, pod web-0 is selected by networkpolicy shop/default-deny, shop/allow-ingress-nginx, shop/allow-office and no ingress rule matches"},
+		{netkat.TrafficSource{Namespace: "ingress-nginx", Labels: map[string]string{"app.kubernetes.io/name": "ingress-nginx"}}, web, true, "ingress allowed by networkpolicy shop/allow-ingress-nginx rule 0"},
+		{netkat.TrafficSource{Cidr: cidr("203.0.113.0/26")}, netkat.PodPort{PodName: "web-1", Namespace: "shop", Labels: map[string]string{"app": "web"}, ContainerPort: 8050}, true, "ingress allowed by networkpolicy shop/allow-office rule 0"},
+		{netkat.TrafficSource{Cidr: cidr("203.0.113.0/24")}, netkat.PodPort{PodName: "web-1", Namespace: "shop", Labels: map[string]string{"app": "web"}, ContainerPort: 8050}, false, "ingress denied, pod web-1 is selected by networkpolicy shop/default-deny, shop/allow-ingress-nginx, shop/allow-office and no ingress rule matches"},
+		{job, netkat.PodPort{PodName: "db-0", Namespace: "warehouse", ContainerPort: 5432}, true, "egress allowed by networkpolicy batch/restrict-egress rule 0"},
+		{job, api, false, "egress denied, pod batch/job-0 is selected by networkpolicy batch/restrict-egress and no egress rule matches"},
+		{netkat.TrafficSource{Namespace: "other"}, netkat.PodPort{PodName: "db-0", Namespace: "warehouse", ContainerPort: 5432}, true, "ingress allowed, no networkpolicy selects pod db-0"},
+	}
+)
+
+func cidr(value string) *net.IPNet {
+	_, ipNet, _ := net.ParseCIDR(value)
+	return ipNet
+}
+
+func (s *StoreSuite) TestEvaluateNetworkPolicies() {
+	var apiNetworkPolicies netkat.NetworkPolicyList
+	err := json.Unmarshal([]byte(NetworkPolicyListJson), &apiNetworkPolicies)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	components := netkat.KubernetesComponents{
+		NetworkPolicies: apiNetworkPolicies.Items,
+		NamespaceLabels: map[string]map[string]string{
+			"shop":          {"kubernetes.io/metadata.name": "shop"},
+			"ingress-nginx": {"kubernetes.io/metadata.name": "ingress-nginx"},
+			"warehouse":     {"kubernetes.io/metadata.name": "warehouse", "team": "data"},
+		},
+	}
+	for _, test := range NetworkPolicyTests {
+		source, podPort := test.Source, test.PodPort
+		verdict := components.EvaluateNetworkPolicies(&source, &podPort)
+		assert.Equal(s.T(), test.Allowed, verdict.Allowed, test.Reason)
+		assert.Contains(s.T(), verdict.Reasons, test.Reason)
+	}
+}
+
+func (s *StoreSuite) TestParseSourceKinds() {
+	var ch netkat.Checker
+	assert.Nil(s.T(), ch.ParseSource("namespace/ingress-nginx"))
+	assert.Equal(s.T(), netkat.NamespaceTarget, ch.Source.Kind)
+	assert.Equal(s.T(), "ingress-nginx", ch.Source.Namespace)
+	assert.Nil(s.T(), ch.ParseSource("203.0.113.7"))
+	assert.Equal(s.T(), "203.0.113.7/32", ch.Source.Cidr.String())
+	assert.Nil(s.T(), ch.ParseSource("10.0.0.0/8"))
+	assert.Equal(s.T(), netkat.CidrTarget, ch.Source.Kind)
+}
+
+func (s *StoreSuite) TestCheckNetworkPoliciesPodFromCidr() {
+	var apiNetworkPolicies netkat.NetworkPolicyList
+	err := json.Unmarshal([]byte(NetworkPolicyListJson), &apiNetworkPolicies)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	controllerLabels := map[string]string{"app.kubernetes.io/name": "ingress-nginx"}
+	controller := netkat.PodPort{PodName: "ingress-nginx-controller-0", Namespace: "ingress-nginx", Labels: controllerLabels, PortName: "http", ContainerPort: 80}
+	CidrTests := []struct {
+		Ingress               *netkat.IngressPath
+		ExternalTrafficPolicy string
+		Passed                int
+	}{
+		// The office isn't allowed to reach web-0 directly, but through the controller the pods see its address.
+		{&netkat.IngressPath{IngressName: "web", IngressClassName: "nginx"}, "Local", 1},
+		{&netkat.IngressPath{IngressName: "web", IngressClassName: "nginx"}, "Cluster", 1},
+		{nil, "", 0},
+	}
+	for _, test := range CidrTests {
+		lb := netkat.ServicePort{
+			Type: "LoadBalancer", ServiceName: "ingress-nginx-controller", Namespace: "ingress-nginx", Selector: controllerLabels,
+			SourcePort: 80, TargetPortName: "http", ExternalTrafficPolicy: test.ExternalTrafficPolicy,
+		}
+		var ch netkat.Checker
+		ch.Target = &netkat.Target{Kind: netkat.HostTarget, Port: 80}
+		ch.Source = &netkat.Target{Kind: netkat.CidrTarget, Cidr: cidr("198.51.100.0/24")}
+		ch.KubernetesComponents = &netkat.KubernetesComponents{
+			PodPorts:        []*netkat.PodPort{&controller, &web},
+			ServicePorts:    []*netkat.ServicePort{&lb},
+			NetworkPolicies: apiNetworkPolicies.Items,
+			NamespaceLabels: map[string]map[string]string{
+				"shop":          {"kubernetes.io/metadata.name": "shop"},
+				"ingress-nginx": {"kubernetes.io/metadata.name": "ingress-nginx"},
+			},
+		}
+		ch.KubernetesRoute = &netkat.KubernetesRoute{Ingress: test.Ingress, Pods: []*netkat.PodPort{&web}}
+		ch.CheckNetworkPoliciesPod()
+		assert.Equal(s.T(), test.Passed, len(ch.PassedChecks), test.ExternalTrafficPolicy)
+	}
+
+	var ch netkat.Checker
+	ch.Source = &netkat.Target{Kind: netkat.NamespaceTarget, Namespace: "shop"}
+	ch.KubernetesComponents = &netkat.KubernetesComponents{NetworkPolicyErr: errors.New("networkpolicies.networking.k8s.io is forbidden")}
+	ch.KubernetesRoute = &netkat.KubernetesRoute{Pods: []*netkat.PodPort{&web}}
+	ch.CheckNetworkPoliciesPod()
+	assert.Empty(s.T(), ch.PassedChecks, "Expected policies that couldn't be listed not to allow traffic")
+	assert.Equal(s.T(), 1, len(ch.SkippedChecks))
+}
+
+func (s *StoreSuite) TestFindIngressControllerPods() {
+	components := netkat.KubernetesComponents{PodPorts: []*netkat.PodPort{
+		{PodName: "ingress-nginx-controller-0", Namespace: "ingress-nginx", Labels: map[string]string{"app.kubernetes.io/name": "ingress-nginx"}, ContainerPort: 80},
+		{PodName: "ingress-nginx-controller-0", Namespace: "ingress-nginx", Labels: map[string]string{"app.kubernetes.io/name": "ingress-nginx"}, ContainerPort: 443},
+		{PodName: "traefik-0", Namespace: "traefik", Labels: map[string]string{"app.kubernetes.io/name": "traefik"}, ContainerPort: 8000},
+	}}
+	var descriptions []string
+	for _, source := range components.FindIngressControllerPods(&netkat.IngressPath{IngressClassName: "nginx"}) {
+		descriptions = append(descriptions, source.Description)
+	}
+	assert.Equal(s.T(), []string{"ingress controller pod ingress-nginx/ingress-nginx-controller-0"}, descriptions)
+	descriptions = nil
+	for _, source := range components.FindIngressControllerPods(&netkat.IngressPath{IngressClassName: "traefik"}) {
+		descriptions = append(descriptions, source.Description)
+	}
+	assert.Equal(s.T(), []string{"ingress controller pod traefik/traefik-0"}, descriptions)
+}
@@ -0,0 +1,134 @@
+package netkat
+
+import (
+	"fmt"
+	"k8s.io/api/core/v1"
+)
+
+type (
+	// ContainerHealth is the part of a container status that explains why a pod isn't serving traffic.
+	ContainerHealth struct {
+		Name         string `json:"name,omitempty"`
+		Ready        bool   `json:"ready"`
+		RestartCount int32  `json:"restartCount,omitempty"`
+		// WaitingReason is set while the container isn't running, such as CrashLoopBackOff or ImagePullBackOff.
+		WaitingReason         string `json:"waitingReason,omitempty"`
+		Running               bool   `json:"running"`
+		LastTerminationReason string `json:"lastTerminationReason,omitempty"`
+		LastExitCode          int32  `json:"lastExitCode,omitempty"`
+		// TerminatedReason is set while the container is stopped, such as OOMKilled, Error or Completed.
+		TerminatedReason string `json:"terminatedReason,omitempty"`
+		ExitCode         int32  `json:"exitCode,omitempty"`
+		// Init is set for init containers, which must all complete before the other containers start.
+		Init bool `json:"init,omitempty"`
+	}
+)
+
+func podContainerHealth(pod *v1.Pod) (containers []ContainerHealth) {
+	for _, status := range pod.Status.InitContainerStatuses {
+		containers = append(containers, containerHealth(status, true))
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		containers = append(containers, containerHealth(status, false))
+	}
+	return
+}
+
+func containerHealth(status v1.ContainerStatus, init bool) (container ContainerHealth) {
+	container = ContainerHealth{
+		Name:         status.Name,
+		Ready:        status.Ready,
+		RestartCount: status.RestartCount,
+		Running:      status.State.Running != nil,
+		Init:         init,
+	}
+	if status.State.Waiting != nil {
+		container.WaitingReason = status.State.Waiting.Reason
+	}
+	if status.State.Terminated != nil {
+		container.TerminatedReason = status.State.Terminated.Reason
+		container.ExitCode = status.State.Terminated.ExitCode
+	}
+	if status.LastTerminationState.Terminated != nil {
+		container.LastTerminationReason = status.LastTerminationState.Terminated.Reason
+		container.LastExitCode = status.LastTerminationState.Terminated.ExitCode
+	}
+	return
+}
+
+// podReadyCondition returns the pod Ready condition, with its reason when the pod isn't ready.
+func podReadyCondition(pod *v1.Pod) (ready bool, reason string) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type != v1.PodReady {
+			continue
+		}
+		ready = condition.Status == v1.ConditionTrue
+		if !ready {
+			reason = condition.Reason
+			if condition.Message != "" {
+				reason = fmt.Sprintf("%s: %s", reason, condition.Message)
+			}
+		}
+		return
+	}
+	return
+}
+
+// terminalPhase reports whether the pod has run to completion, Succeeded or Failed, and will never serve again.
+// Kubernetes leaves such pods out of the endpoints even when the service selects them.
+func terminalPhase(phase string) bool {
+	return phase == string(v1.PodSucceeded) || phase == string(v1.PodFailed)
+}
+
+// HealthProblems explains why the pod wouldn't receive traffic: a phase other than Running, init containers that
+// failed or haven't completed, containers that are waiting, crash looping or terminated, containers failing their
+// readiness probe, or an unready pod condition.
+func (p *PodPort) HealthProblems() (problems []string) {
+	if p.PodStatus != string(v1.PodRunning) {
+		problems = append(problems, fmt.Sprintf("pod phase is %s", p.PodStatus))
+	}
+	for _, c := range p.Containers {
+		if problem := c.problem(); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) == 0 && !p.Ready {
+		reason := p.ReadyReason
+		if reason == "" {
+			reason = "Ready condition is not true"
+		}
+		problems = append(problems, fmt.Sprintf("pod is not ready: %s", reason))
+	}
+	return
+}
+
+func (c *ContainerHealth) problem() string {
+	kind := "container"
+	if c.Init {
+		kind = "init container"
+	}
+	switch {
+	case c.WaitingReason != "":
+		return fmt.Sprintf("%s '%s' is waiting: %s%s", kind, c.Name, c.WaitingReason, c.lastTermination())
+	case c.Init && c.TerminatedReason != "" && c.ExitCode == 0:
+		return ""
+	case c.TerminatedReason != "":
+		return fmt.Sprintf("%s '%s' has terminated: %s, exit code %d%s", kind, c.Name, c.TerminatedReason, c.ExitCode, c.lastTermination())
+	case c.Init && c.Running && !c.Ready:
+		return fmt.Sprintf("init container '%s' has not completed", c.Name)
+	case c.Init:
+		return ""
+	case c.Running && !c.Ready:
+		return fmt.Sprintf("container '%s' is running but failing its readiness probe%s", c.Name, c.lastTermination())
+	case !c.Ready:
+		return fmt.Sprintf("container '%s' is not ready%s", c.Name, c.lastTermination())
+	}
+	return ""
+}
+
+func (c *ContainerHealth) lastTermination() string {
+	if c.LastTerminationReason == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (last terminated: %s, exit code %d, %d restarts)", c.LastTerminationReason, c.LastExitCode, c.RestartCount)
+}
@@ -0,0 +1,94 @@
+package netkat_test
+
+import (
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type (
+	PodHealthTest struct {
+		PodPort  netkat.PodPort
+		Expected []string
+	}
+)
+
+var (
+	PodHealthTests = []PodHealthTest{
+		{netkat.PodPort{PodStatus: "Running", Ready: true, Containers: []netkat.ContainerHealth{{Name: "web", Ready: true, Running: true}}}, nil},
+		{netkat.PodPort{PodStatus: "Pending"}, []string{"pod phase is Pending"}},
+		{
+			netkat.PodPort{PodStatus: "Running", Containers: []netkat.ContainerHealth{
+				{Name: "web", WaitingReason: "CrashLoopBackOff", RestartCount: 5, LastTerminationReason: "OOMKilled", LastExitCode: 137},
+			}},
+			[]string{"container 'web' is waiting: CrashLoopBackOff (last terminated: OOMKilled, exit code 137, 5 restarts)"},
+		},
+		{
+			netkat.PodPort{PodStatus: "Running", Containers: []netkat.ContainerHealth{
+				{Name: "web", Ready: true, Running: true},
+				{Name: "sidecar", Running: true},
+			}},
+			[]string{"container 'sidecar' is running but failing its readiness probe"},
+		},
+		{
+			netkat.PodPort{PodStatus: "Running", ReadyReason: "ReadinessGatesNotReady", Containers: []netkat.ContainerHealth{{Name: "web", Ready: true, Running: true}}},
+			[]string{"pod is not ready: ReadinessGatesNotReady"},
+		},
+		{
+			netkat.PodPort{PodStatus: "Running", Containers: []netkat.ContainerHealth{
+				{Name: "web", TerminatedReason: "OOMKilled", ExitCode: 137, RestartCount: 1},
+			}},
+			[]string{"container 'web' has terminated: OOMKilled, exit code 137"},
+		},
+		{
+			netkat.PodPort{PodStatus: "Pending", Containers: []netkat.ContainerHealth{
+				{Name: "wait-for-db", Init: true, TerminatedReason: "Completed"},
+				{Name: "migrate", Init: true, WaitingReason: "CrashLoopBackOff", RestartCount: 4, LastTerminationReason: "Error", LastExitCode: 1},
+				{Name: "web", WaitingReason: "PodInitializing"},
+			}},
+			[]string{
+				"pod phase is Pending",
+				"init container 'migrate' is waiting: CrashLoopBackOff (last terminated: Error, exit code 1, 4 restarts)",
+				"container 'web' is waiting: PodInitializing",
+			},
+		},
+	}
+)
+
+func (s *StoreSuite) TestHealthProblems() {
+	for _, test := range PodHealthTests {
+		assert.Equal(s.T(), test.Expected, test.PodPort.HealthProblems())
+	}
+}
+
+func (s *StoreSuite) TestPodsToPodPortsHealth() {
+	apiPods := v1.PodList{Items: []v1.Pod{{
+		ObjectMeta: metav1.ObjectMeta{Name: "web-a", Namespace: "default"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "web", Ports: []v1.ContainerPort{{ContainerPort: 8080}}}}},
+		Status: v1.PodStatus{
+			Phase:      v1.PodRunning,
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse, Reason: "ContainersNotReady"}},
+			InitContainerStatuses: []v1.ContainerStatus{{
+				Name:  "migrate",
+				State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Completed"}},
+			}},
+			ContainerStatuses: []v1.ContainerStatus{{
+				Name:                 "web",
+				RestartCount:         3,
+				State:                v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				LastTerminationState: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 1}},
+			}},
+		},
+	}}}
+	podPorts := netkat.PodsToPodPorts(&apiPods)
+	assert.Equal(s.T(), 1, len(podPorts))
+	assert.False(s.T(), podPorts[0].Ready)
+	assert.Equal(s.T(), "ContainersNotReady", podPorts[0].ReadyReason)
+	assert.Equal(s.T(), "migrate", podPorts[0].Containers[0].Name)
+	assert.True(s.T(), podPorts[0].Containers[0].Init)
+	assert.Equal(s.T(), "Completed", podPorts[0].Containers[0].TerminatedReason)
+	assert.Equal(s.T(), "CrashLoopBackOff", podPorts[0].Containers[1].WaitingReason)
+	assert.Equal(s.T(), "Error", podPorts[0].Containers[1].LastTerminationReason)
+	assert.Equal(s.T(), int32(3), podPorts[0].Containers[1].RestartCount)
+}
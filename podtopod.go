@@ -0,0 +1,280 @@
+package netkat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// PodToPodProbe is one connection attempt made from inside the source pod.
+	PodToPodProbe struct {
+		Layer       string
+		Destination string
+		Command     []string
+		Reachable   bool
+		Output      string
+	}
+
+	// PodExec runs commands in a container of the source pod.
+	PodExec struct {
+		Client    *Client
+		Namespace string
+		PodName   string
+		Container string
+	}
+)
+
+const (
+	LayerDns       = "dns"
+	LayerClusterIp = "cluster ip"
+	LayerPodIp     = "pod ip"
+
+	DefaultDebugImage = "busybox:1.36"
+	debugTimeout      = 60 * time.Second
+	connectTimeout    = 3
+)
+
+const (
+	// toolsScript checks the source container has a shell with the tools the probes need, nc or bash to connect.
+	toolsScript = "(command -v nc || command -v bash) >/dev/null && (command -v nslookup || command -v getent) >/dev/null"
+	// connectScript prefers nc, falling back to bash's /dev/tcp.
+	connectScript = `if command -v nc >/dev/null; then nc -z -w %[3]d %[1]s %[2]d; else timeout %[3]d bash -c "</dev/tcp/%[1]s/%[2]d"; fi`
+	lookupScript  = "getent hosts %[1]s || nslookup %[1]s"
+)
+
+var (
+	// errSourceHasNoTools is returned by SourceExec when the source pod lacks the tools and no debug container
+	// may be attached.
+	errSourceHasNoTools = errors.New("the source pod has no shell with nslookup or getent and nc or bash")
+)
+
+// ParseSource parses the --from source: a pod as pod/name[.namespace], defaulting to the default namespace, a
+// namespace as namespace/name, or an external address or CIDR.
+func (ch *Checker) ParseSource(ref string) (err error) {
+	switch {
+	case strings.HasPrefix(ref, "pod/"):
+		name, namespace := splitNameNamespace(strings.TrimPrefix(ref, "pod/"))
+		ch.Source = &Target{Kind: PodTarget, Name: name, Namespace: namespace}
+		if namespace == "" {
+			ch.Source.Namespace = "default"
+		}
+	case strings.HasPrefix(ref, "namespace/"), strings.HasPrefix(ref, "ns/"):
+		ch.Source = &Target{Kind: NamespaceTarget, Namespace: ref[strings.Index(ref, "/")+1:]}
+	default:
+		var ipNet *net.IPNet
+		ipNet, err = parseAddressOrCidr(ref)
+		if err != nil {
+			err = fmt.Errorf("invalid --from '%s', expected pod/name[.namespace], namespace/name or an address or cidr", ref)
+			return
+		}
+		ch.Source = &Target{Kind: CidrTarget, Cidr: ipNet}
+	}
+	return
+}
+
+// parseAddressOrCidr parses a CIDR, treating a bare address as a single host.
+func parseAddressOrCidr(value string) (ipNet *net.IPNet, err error) {
+	cidr := value
+	if !strings.Contains(cidr, "/") {
+		if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+			cidr = cidr + "/32"
+		} else {
+			cidr = cidr + "/128"
+		}
+	}
+	_, ipNet, err = net.ParseCIDR(cidr)
+	return
+}
+
+// PodToPodProbes lists the connections to try from the source pod, one per layer of the route: the service DNS
+// name, the service ClusterIP and the IP of every pod behind it. The DNS name is resolved and then connected to,
+// on the target port for headless services whose name resolves to the pod IPs.
+func PodToPodProbes(s *ServicePort, pods []*PodPort, clusterDomain string) (probes []*PodToPodProbe) {
+	if s != nil {
+		dnsName := fmt.Sprintf("%s.%s.svc.%s", s.ServiceName, s.Namespace, clusterDomain)
+		port := s.SourcePort
+		if s.Headless && len(pods) > 0 {
+			port = pods[0].ContainerPort
+		}
+		probe := connectProbe(LayerDns, dnsName, port)
+		probe.Command = []string{"sh", "-c", fmt.Sprintf(lookupScript, dnsName) + " && " + probe.Command[2]}
+		probes = append(probes, probe)
+		if !s.Headless && s.ClusterIP != nil {
+			probes = append(probes, connectProbe(LayerClusterIp, s.ClusterIP.String(), s.SourcePort))
+		}
+	}
+	for _, p := range pods {
+		if p.PodIP != nil {
+			probes = append(probes, connectProbe(LayerPodIp, p.PodIP.String(), p.ContainerPort))
+		}
+	}
+	return
+}
+
+func connectProbe(layer string, host string, port int32) *PodToPodProbe {
+	return &PodToPodProbe{
+		Layer:       layer,
+		Destination: net.JoinHostPort(host, strconv.Itoa(int(port))),
+		Command:     []string{"sh", "-c", fmt.Sprintf(connectScript, host, port, connectTimeout)},
+	}
+}
+
+// DiagnosePodToPod names the layer the route breaks at. Pod IPs are the lowest layer, so when they fail the
+// ClusterIP and DNS results say nothing more about the cause.
+func DiagnosePodToPod(probes []*PodToPodProbe) (diagnosis string, ok bool) {
+	failed := make(map[string]int)
+	total := make(map[string]int)
+	for _, pr := range probes {
+		total[pr.Layer]++
+		if !pr.Reachable {
+			failed[pr.Layer]++
+		}
+	}
+	switch {
+	case total[LayerPodIp] > 0 && failed[LayerPodIp] == total[LayerPodIp]:
+		return "no pod ip is reachable, check network policies and the CNI", false
+	case failed[LayerPodIp] > 0:
+		return fmt.Sprintf("%d of %d pod ips are unreachable, check network policies and the nodes of those pods", failed[LayerPodIp], total[LayerPodIp]), false
+	case failed[LayerClusterIp] > 0:
+		return "pod ips are reachable but the cluster ip is not, check kube-proxy and the service endpoints", false
+	case failed[LayerDns] > 0:
+		return "the service is reachable by ip but its dns name does not resolve, check the cluster dns", false
+	}
+	return "every layer is reachable", true
+}
+
+// SourceExec finds a container of the source pod with a shell and the probe tools, and otherwise attaches an
+// ephemeral debug container running the debug image when debugContainer allows it, as it can't be removed.
+func (c *Client) SourceExec(source *Target, debugImage string, debugContainer bool) (exec *PodExec, err error) {
+	pod, err := c.CoreV1().Pods(source.Namespace).Get(source.Name, metav1.GetOptions{})
+	if err != nil {
+		return
+	}
+	if len(pod.Spec.Containers) == 0 {
+		err = fmt.Errorf("pod '%s' has no containers", pod.Name)
+		return
+	}
+	exec = &PodExec{Client: c, Namespace: pod.Namespace, PodName: pod.Name, Container: pod.Spec.Containers[0].Name}
+	if _, toolsErr := exec.Run([]string{"sh", "-c", toolsScript}); toolsErr == nil {
+		return
+	}
+	if !debugContainer {
+		exec, err = nil, errSourceHasNoTools
+		return
+	}
+	exec.Container, err = c.AddDebugContainer(pod, debugImage)
+	if err != nil {
+		exec = nil
+	}
+	return
+}
+
+// AddDebugContainer attaches an ephemeral container to the pod, which shares its network namespace, and waits
+// for it to start. Clusters from 1.23 patch the ephemeralcontainers subresource with the pod, older clusters
+// replace an EphemeralContainers object. Ephemeral containers can't be removed, so the netkat-debug container
+// stays in the pod spec until the pod is replaced; its sleep command only keeps it running for a while.
+func (c *Client) AddDebugContainer(pod *v1.Pod, image string) (containerName string, err error) {
+	containerName = "netkat-debug-" + rand.String(5)
+	debug := v1.EphemeralContainer{
+		EphemeralContainerCommon: v1.EphemeralContainerCommon{
+			Name:            containerName,
+			Image:           image,
+			Command:         []string{"sleep", strconv.Itoa(int(debugTimeout.Seconds()) * 10)},
+			ImagePullPolicy: v1.PullIfNotPresent,
+		},
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{"ephemeralContainers": []v1.EphemeralContainer{debug}},
+	})
+	if err != nil {
+		return
+	}
+	err = c.CoreV1().RESTClient().Patch(types.StrategicMergePatchType).
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("ephemeralcontainers").
+		Body(patch).
+		Do().
+		Error()
+	if legacyEphemeralContainers(err) {
+		var ephemeralContainers *v1.EphemeralContainers
+		ephemeralContainers, err = c.CoreV1().Pods(pod.Namespace).GetEphemeralContainers(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return
+		}
+		ephemeralContainers.EphemeralContainers = append(ephemeralContainers.EphemeralContainers, debug)
+		_, err = c.CoreV1().Pods(pod.Namespace).UpdateEphemeralContainers(pod.Name, ephemeralContainers)
+	}
+	if err != nil {
+		return
+	}
+	deadline := time.Now().Add(debugTimeout)
+	for time.Now().Before(deadline) {
+		var current *v1.Pod
+		current, err = c.CoreV1().Pods(pod.Namespace).Get(pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return
+		}
+		for _, status := range current.Status.EphemeralContainerStatuses {
+			if status.Name == containerName && status.State.Running != nil {
+				return
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	err = fmt.Errorf("timed out after %v waiting for debug container '%s' to start", debugTimeout, containerName)
+	return
+}
+
+// legacyEphemeralContainers reports whether the patch failed because the cluster predates patching ephemeral
+// containers with the pod. Any other failure, such as Forbidden, is returned as it is. A missing pod is also
+// NotFound, but names the pod in its details.
+func legacyEphemeralContainers(err error) bool {
+	if apierrors.IsMethodNotSupported(err) {
+		return true
+	}
+	status, ok := err.(apierrors.APIStatus)
+	return ok && apierrors.IsNotFound(err) && (status.Status().Details == nil || status.Status().Details.Name == "")
+}
+
+// Run execs the command in the container and returns its combined output. Commands exiting non-zero return an
+// error with the output.
+func (e *PodExec) Run(command []string) (output string, err error) {
+	request := e.Client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(e.Namespace).
+		Name(e.PodName).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: e.Container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewSPDYExecutor(e.Client.Config, http.MethodPost, request.URL())
+	if err != nil {
+		return
+	}
+	var out bytes.Buffer
+	err = executor.Stream(remotecommand.StreamOptions{Stdout: &out, Stderr: &out})
+	output = strings.TrimSpace(out.String())
+	if err != nil && output != "" {
+		err = errors.New(output)
+	}
+	return
+}
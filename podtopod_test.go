@@ -0,0 +1,79 @@
+package netkat_test
+
+import (
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+	"net"
+)
+
+type (
+	DiagnosisTest struct {
+		Unreachable []string
+		Ok          bool
+		Diagnosis   string
+	}
+)
+
+var (
+	DiagnosisTests = []DiagnosisTest{
+		{nil, true, "every layer is reachable"},
+		{[]string{"dns"}, false, "the service is reachable by ip but its dns name does not resolve, check the cluster dns"},
+		{[]string{"dns", "cluster ip"}, false, "pod ips are reachable but the cluster ip is not, check kube-proxy and the service endpoints"},
+		{[]string{"10.1.0.4:8080"}, false, "1 of 2 pod ips are unreachable, check network policies and the nodes of those pods"},
+		{[]string{"cluster ip", "10.1.0.4:8080", "10.1.0.5:8080"}, false, "no pod ip is reachable, check network policies and the CNI"},
+	}
+)
+
+func podToPodProbes() []*netkat.PodToPodProbe {
+	servicePort := netkat.ServicePort{ServiceName: "web", Namespace: "default", ClusterIP: net.ParseIP("10.96.0.20"), SourcePort: 80}
+	pods := []*netkat.PodPort{
+		{PodName: "web-a", PodIP: net.ParseIP("10.1.0.4"), ContainerPort: 8080},
+		{PodName: "web-b", PodIP: net.ParseIP("10.1.0.5"), ContainerPort: 8080},
+	}
+	return netkat.PodToPodProbes(&servicePort, pods, "cluster.local")
+}
+
+func (s *StoreSuite) TestParseSource() {
+	var ch netkat.Checker
+	err := ch.ParseSource("pod/client-7d9f.tools")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	assert.Equal(s.T(), "client-7d9f", ch.Source.Name)
+	assert.Equal(s.T(), "tools", ch.Source.Namespace)
+	err = ch.ParseSource("pod/client-7d9f")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "default", ch.Source.Namespace)
+	err = ch.ParseSource("pod/node-exporter.ip-10-0-1-5.metrics")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "node-exporter.ip-10-0-1-5", ch.Source.Name)
+	assert.Equal(s.T(), "metrics", ch.Source.Namespace)
+	assert.NotNil(s.T(), ch.ParseSource("svc/web"))
+}
+
+func (s *StoreSuite) TestPodToPodProbes() {
+	probes := podToPodProbes()
+	assert.Equal(s.T(), 4, len(probes))
+	assert.Equal(s.T(), "web.default.svc.cluster.local:80", probes[0].Destination)
+	assert.Equal(s.T(), "10.96.0.20:80", probes[1].Destination)
+	assert.Equal(s.T(), "10.1.0.5:8080", probes[3].Destination)
+	headless := netkat.ServicePort{ServiceName: "web", Namespace: "default", Headless: true}
+	assert.Equal(s.T(), 1, len(netkat.PodToPodProbes(&headless, nil, "cluster.local")), "Expected headless services to skip the cluster ip")
+}
+
+func (s *StoreSuite) TestDiagnosePodToPod() {
+	for _, test := range DiagnosisTests {
+		probes := podToPodProbes()
+		for _, pr := range probes {
+			pr.Reachable = true
+			for _, unreachable := range test.Unreachable {
+				if pr.Layer == unreachable || pr.Destination == unreachable {
+					pr.Reachable = false
+				}
+			}
+		}
+		diagnosis, ok := netkat.DiagnosePodToPod(probes)
+		assert.Equal(s.T(), test.Ok, ok, test.Unreachable)
+		assert.Equal(s.T(), test.Diagnosis, diagnosis)
+	}
+}
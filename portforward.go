@@ -0,0 +1,97 @@
+package netkat
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// PortForward is a running port-forward to a pod, bound to an OS-assigned port on the loopback address so
+	// any number can run at once without privileges or clashing with local services.
+	PortForward struct {
+		LocalAddress string
+		stopChan     chan struct{}
+		doneChan     chan struct{}
+		stopOnce     sync.Once
+	}
+)
+
+const (
+	portForwardTimeout = 10 * time.Second
+	// maxConcurrentForwards caps the port-forwards CheckListeningPod opens at once.
+	maxConcurrentForwards = 10
+)
+
+// ForwardPort starts forwarding a local port to the pod's container port, and waits until it is ready or the
+// timeout passes. The caller must Close the forward.
+func (c *Client) ForwardPort(p *PodPort, timeout time.Duration) (forward *PortForward, err error) {
+	roundTripper, upgrader, err := spdy.RoundTripperFor(c.Config)
+	if err != nil {
+		return
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, c.PortForwardURL(p))
+	started := &PortForward{stopChan: make(chan struct{}), doneChan: make(chan struct{})}
+	readyChan := make(chan struct{})
+	forwarder, err := portforward.NewOnAddresses(
+		dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", p.ContainerPort)}, started.stopChan, readyChan, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		return
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- forwarder.ForwardPorts()
+		close(started.doneChan)
+	}()
+	select {
+	case <-readyChan:
+	case err = <-errChan:
+		if err == nil {
+			err = errors.New("port-forward stopped before it was ready")
+		}
+		return
+	case <-time.After(timeout):
+		started.Close()
+		err = fmt.Errorf("timed out after %v waiting for the port-forward to pod '%s'", timeout, p.PodName)
+		return
+	}
+	ports, err := forwarder.GetPorts()
+	if err != nil {
+		started.Close()
+		return
+	}
+	started.LocalAddress = net.JoinHostPort("127.0.0.1", strconv.Itoa(int(ports[0].Local)))
+	forward = started
+	return
+}
+
+// PortForwardURL builds the pod's portforward subresource URL from the REST client, like kubectl, so the API
+// server's scheme, port and path prefix (such as Rancher's /k8s/clusters/<id>) are kept. Proxies are taken from
+// the HTTPS_PROXY and NO_PROXY environment variables by the SPDY round tripper.
+func (c *Client) PortForwardURL(p *PodPort) *url.URL {
+	return c.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(p.Namespace).
+		Name(p.PodName).
+		SubResource("portforward").
+		URL()
+}
+
+// Close stops the port-forward and waits briefly for its listeners and streams to shut down.
+func (f *PortForward) Close() {
+	f.stopOnce.Do(func() {
+		close(f.stopChan)
+	})
+	select {
+	case <-f.doneChan:
+	case <-time.After(portForwardTimeout):
+	}
+}
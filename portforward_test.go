@@ -0,0 +1,58 @@
+package netkat_test
+
+import (
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"time"
+)
+
+type (
+	PortForwardURLTest struct {
+		Host     string
+		Expected string
+	}
+)
+
+var (
+	PortForwardURLTests = []PortForwardURLTest{
+		{"https://10.0.0.1:6443", "https://10.0.0.1:6443/api/v1/namespaces/default/pods/web-a/portforward"},
+		{"https://rancher.example.com/k8s/clusters/c-abc12", "https://rancher.example.com/k8s/clusters/c-abc12/api/v1/namespaces/default/pods/web-a/portforward"},
+		{"http://localhost:8080", "http://localhost:8080/api/v1/namespaces/default/pods/web-a/portforward"},
+		{"https://standby.example.com", "https://standby.example.com/api/v1/namespaces/default/pods/web-a/portforward"},
+	}
+)
+
+func newTestClient(host string) (client netkat.Client, err error) {
+	config := &rest.Config{Host: host}
+	clientSet, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return
+	}
+	client = netkat.Client{Clientset: clientSet, Config: config}
+	return
+}
+
+func (s *StoreSuite) TestPortForwardURL() {
+	for _, test := range PortForwardURLTests {
+		client, err := newTestClient(test.Host)
+		if err != nil {
+			s.T().Fatal(err)
+		}
+		podPort := netkat.PodPort{PodName: "web-a", Namespace: "default", ContainerPort: 8080}
+		assert.Equal(s.T(), test.Expected, client.PortForwardURL(&podPort).String(), test.Host)
+	}
+}
+
+func (s *StoreSuite) TestForwardPortUnreachable() {
+	client, err := newTestClient("https://127.0.0.1:1")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	start := time.Now()
+	forward, err := client.ForwardPort(&netkat.PodPort{PodName: "web-a", Namespace: "default", ContainerPort: 8080}, time.Second)
+	assert.NotNil(s.T(), err)
+	assert.Nil(s.T(), forward)
+	assert.True(s.T(), time.Since(start) < 5*time.Second, "Expected the port-forward to give up")
+}
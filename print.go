@@ -2,8 +2,15 @@ package netkat
 
 import (
 	"fmt"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"net"
+	"net/http"
+	"os"
 	"runtime"
+	"sort"
 	"strings"
+	"text/tabwriter"
 )
 
 func PrintCheckHeader() {
@@ -32,6 +39,14 @@ func PrintCheckResults(ch *Checker) {
 			"    --- %s\n", functionName,
 		)
 	}
+	if len(ch.SkippedChecks) > 0 {
+		fmt.Printf("=== SKIP: (%d/%d)\n", len(ch.SkippedChecks), len(ch.RequiredChecks))
+		for _, functionName := range ch.SkippedChecks {
+			fmt.Printf(
+				"    --- %s\n", functionName,
+			)
+		}
+	}
 
 }
 
@@ -39,15 +54,105 @@ func PrintHost(t *Target) {
 	fmt.Printf("host: %s\n", t.Host)
 	fmt.Printf("port: %d\n", t.Port)
 	fmt.Printf("path: %s\n", t.Path)
-	fmt.Printf("ip address: %s\n", t.IpAddress)
+	if len(t.CnameChain) > 0 {
+		fmt.Printf("cname chain: %s -> %s\n", t.Host, strings.Join(t.CnameChain, " -> "))
+	}
+	fmt.Printf("dns records:\n")
+	for _, r := range t.Records {
+		fmt.Printf("   %s\n", formatDnsRecord(r))
+	}
+
+}
+
+func PrintDnsRecordRoute(r *DnsRecord, i *IngressPath, s *ServicePort, indent int) {
+	switch {
+	case i != nil:
+		fmt.Printf("%v%s -> ingress: %s/%s\n", strings.Repeat(" ", indent), formatDnsRecord(r), i.Namespace, i.IngressName)
+	case s != nil:
+		fmt.Printf("%v%s -> service: %s/%s\n", strings.Repeat(" ", indent), formatDnsRecord(r), s.Namespace, s.ServiceName)
+	default:
+		fmt.Printf("%v%s -> nothing in the cluster\n", strings.Repeat(" ", indent), formatDnsRecord(r))
+	}
+}
+
+func PrintHostProbe(t *Target, r *DnsRecord, response *http.Response) {
+	fmt.Printf("%s %s://%s%s -> %s\n", r.IpAddress, t.Scheme, t.Host, t.Path, response.Status)
+}
+
+func PrintHostPortProbe(t *Target, r *DnsRecord, result string) {
+	fmt.Printf("%s %s://%s:%d -> %s\n", r.IpAddress, t.Scheme, t.Host, t.Port, result)
+}
+
+func PrintInternalHost(t *Target) {
+	fmt.Printf("host: %s\n", t.Host)
+	fmt.Printf("port: %d\n", t.Port)
+	if t.Name != "" {
+		fmt.Printf("service: %s\n", t.Name)
+	}
+	if t.Hostname != "" {
+		fmt.Printf("hostname: %s\n", t.Hostname)
+	}
+	if t.IpAddress != nil {
+		fmt.Printf("pod ip address: %s\n", t.IpAddress)
+	}
+	fmt.Printf("namespace: %s\n", t.Namespace)
+}
+
+func PrintPodTarget(t *Target) {
+	fmt.Printf("pod: %s\n", t.Name)
+	fmt.Printf("namespace: %s\n", t.Namespace)
+	fmt.Printf("port: %s\n", targetPort(t))
+}
+
+func PrintServiceTarget(t *Target) {
+	fmt.Printf("service: %s\n", t.Name)
+	fmt.Printf("namespace: %s\n", t.Namespace)
+	fmt.Printf("port: %s\n", targetPort(t))
+}
 
+func PrintSection(name string) {
+	fmt.Printf("%s:\n", name)
+}
+
+func PrintIngressPathMatches(matches []*IngressPathMatch) {
+	if len(matches) == 0 || (len(matches) == 1 && !matches[0].IngressPath.DefaultBackend) {
+		return
+	}
+	fmt.Printf("ingress path candidates:\n")
+	for _, m := range matches {
+		rule := m.IngressPath.Host + m.IngressPath.Path
+		if m.IngressPath.DefaultBackend {
+			rule = "default backend"
+		}
+		fmt.Printf("   %s (%s): %s\n", rule, m.IngressPath.IngressName, m.Reason)
+	}
 }
 
 func PrintIngressPath(i *IngressPath, indent int) {
-	fmt.Printf("%v-> ingress: %s\n", strings.Repeat(" ", indent), i.IngressName)
+	fmt.Printf("%v-> %s: %s\n", strings.Repeat(" ", indent), ingressKind(i), i.IngressName)
 	fmt.Printf("%v   namespace: %s\n", strings.Repeat(" ", indent), i.Namespace)
+	fmt.Printf("%v   host: %s\n", strings.Repeat(" ", indent), i.Host)
 	fmt.Printf("%v   path: %s\n", strings.Repeat(" ", indent), i.Path)
-	fmt.Printf("%v   ip address: %s\n", strings.Repeat(" ", indent), i.IpAddress)
+	if i.DefaultBackend {
+		fmt.Printf("%v   default backend: true\n", strings.Repeat(" ", indent))
+	}
+	if i.PathType != "" {
+		fmt.Printf("%v   path type: %s\n", strings.Repeat(" ", indent), i.PathType)
+	}
+	if i.IngressClassName != "" {
+		fmt.Printf("%v   ingress class: %s\n", strings.Repeat(" ", indent), i.IngressClassName)
+	}
+	if i.IngressClassController != "" {
+		fmt.Printf("%v   ingress class controller: %s\n", strings.Repeat(" ", indent), i.IngressClassController)
+	}
+	fmt.Printf("%v   ip address: %s\n", strings.Repeat(" ", indent), joinIPs(i.IpAddresses))
+	if len(i.LoadBalancerHostnames) > 0 {
+		fmt.Printf("%v   load balancer hostname: %s\n", strings.Repeat(" ", indent), strings.Join(i.LoadBalancerHostnames, ", "))
+	}
+}
+
+func PrintNoIngress(indent int) {
+	fmt.Printf("%v-> ingress: none\n", strings.Repeat(" ", indent))
 }
 
 func PrintServicePort(s *ServicePort, indent int) {
@@ -62,7 +167,7 @@ func PrintServicePort(s *ServicePort, indent int) {
 	}
 
 	if s.TargetPortName != "" {
-		dstPort = fmt.Sprintf("%s (%d)", s.TargetPortName, s.TargetPort)
+		dstPort = fmt.Sprintf("%s (%s)", s.TargetPortName, resolvedTargetPorts(s))
 	} else if s.TargetPort == 0 {
 		dstPort = fmt.Sprintf("%s", s.TargetPortName)
 	} else {
@@ -71,16 +176,190 @@ func PrintServicePort(s *ServicePort, indent int) {
 
 	fmt.Printf("%v-> service: %s\n", strings.Repeat(" ", indent), s.ServiceName)
 	fmt.Printf("%v   namespace: %s\n", strings.Repeat(" ", indent), s.Namespace)
-	fmt.Printf("%v   app selector: %s\n", strings.Repeat(" ", indent), s.AppSelector)
+	fmt.Printf("%v   selector: %s\n", strings.Repeat(" ", indent), labels.Set(s.Selector))
 	fmt.Printf("%v   external IP: %s\n", strings.Repeat(" ", indent), s.ExternalIP)
 	fmt.Printf("%v   internal IP: %s\n", strings.Repeat(" ", indent), s.ClusterIP)
 	fmt.Printf("%v   mapping: %s -> %s\n", strings.Repeat(" ", indent), srcPort, dstPort)
 }
 
+// resolvedTargetPorts shows the number a named target port resolves to, per pod when the pods disagree.
+func resolvedTargetPorts(s *ServicePort) string {
+	var podNames []string
+	numbers := make(map[int32]bool)
+	for podName, port := range s.ResolvedTargetPorts {
+		podNames = append(podNames, podName)
+		numbers[port] = true
+	}
+	sort.Strings(podNames)
+	switch {
+	case len(podNames) == 0:
+		return "not declared by any selected pod"
+	case len(numbers) == 1:
+		return fmt.Sprintf("%d", s.ResolvedTargetPorts[podNames[0]])
+	}
+	var ports []string
+	for _, podName := range podNames {
+		ports = append(ports, fmt.Sprintf("%d on %s", s.ResolvedTargetPorts[podName], podName))
+	}
+	return strings.Join(ports, ", ")
+}
+
 func PrintPodPort(p *PodPort, indent int) {
 	fmt.Printf("%v-> pod: %s\n", strings.Repeat(" ", indent), p.PodName)
 	fmt.Printf("%v   namespace: %s\n", strings.Repeat(" ", indent), p.Namespace)
-	fmt.Printf("%v   app: %s\n", strings.Repeat(" ", indent), p.App)
+	fmt.Printf("%v   labels: %s\n", strings.Repeat(" ", indent), labels.Set(p.Labels))
 	fmt.Printf("%v   container: %s\n", strings.Repeat(" ", indent), p.ContainerName)
-	fmt.Printf("%v   port: %d\n", strings.Repeat(" ", indent), p.ContainerPort)
+	if p.PortName != "" {
+		fmt.Printf("%v   port: %s (%d)\n", strings.Repeat(" ", indent), p.PortName, p.ContainerPort)
+	} else {
+		fmt.Printf("%v   port: %d\n", strings.Repeat(" ", indent), p.ContainerPort)
+	}
+}
+
+func PrintPodResults(results []*PodResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "POD\tNODE\tIMAGE\tSTATUS\tLISTENING")
+	for _, r := range results {
+		listening := r.Listening
+		if listening == "" {
+			listening = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.PodPort.PodName, r.PodPort.NodeName, r.PodPort.ContainerImage, r.Status(), listening)
+	}
+	_ = w.Flush()
+}
+
+func PrintPolicyVerdict(v *PolicyVerdict, indent int) {
+	result := "allowed"
+	if !v.Allowed {
+		result = "denied"
+	}
+	fmt.Printf("%v-> pod: %s port %d: %s\n", strings.Repeat(" ", indent), v.PodPort.PodName, v.PodPort.ContainerPort, result)
+	for _, reason := range v.Reasons {
+		fmt.Printf("%v   %s\n", strings.Repeat(" ", indent), reason)
+	}
+}
+
+func PrintNotEvaluated(reason string, indent int) {
+	fmt.Printf("%vnot evaluated, %s\n", strings.Repeat(" ", indent), reason)
+}
+
+func PrintServiceSourceRanges(s *ServicePort, v *SourceRangeVerdict, indent int) {
+	fmt.Printf("%v-> service: %s.%s\n", strings.Repeat(" ", indent), s.ServiceName, s.Namespace)
+	fmt.Printf("%v   external traffic policy: %s\n", strings.Repeat(" ", indent), externalTrafficPolicy(s.ExternalTrafficPolicy))
+	PrintSourceRangeVerdict(v, s.SourceRangesFrom, indent)
+}
+
+func PrintSourceRangeVerdict(v *SourceRangeVerdict, from string, indent int) {
+	if len(v.Ranges) == 0 {
+		fmt.Printf("%v   source ranges: none, open to every address\n", strings.Repeat(" ", indent))
+		return
+	}
+	var ranges []string
+	for _, r := range v.Ranges {
+		ranges = append(ranges, r.String())
+	}
+	fmt.Printf("%v   source ranges: %s (from %s)\n", strings.Repeat(" ", indent), strings.Join(ranges, ", "), from)
+	if v.Allowed {
+		fmt.Printf("%v   originating IP: %s allowed by %s\n", strings.Repeat(" ", indent), v.OriginIp, v.Match)
+		return
+	}
+	fmt.Printf("%v   originating IP: %s denied\n", strings.Repeat(" ", indent), v.OriginIp)
+}
+
+func PrintIngressSourceRanges(i *IngressPath, clientAddress string, v *IngressSourceRangeVerdict, indent int) {
+	result := "allowed"
+	if !v.Allowed {
+		result = "denied"
+	}
+	fmt.Printf("%v-> ingress: %s.%s\n", strings.Repeat(" ", indent), i.IngressName, i.Namespace)
+	fmt.Printf("%v   client address: %s\n", strings.Repeat(" ", indent), clientAddress)
+	fmt.Printf("%v   originating IP: %s %s\n", strings.Repeat(" ", indent), v.OriginIp, result)
+	for _, reason := range v.Reasons {
+		fmt.Printf("%v   %s\n", strings.Repeat(" ", indent), reason)
+	}
+}
+
+func PrintControllerWorkload(w *ControllerWorkload, indent int) {
+	fmt.Printf("%v-> %s: %s.%s (%d/%d ready)\n", strings.Repeat(" ", indent), strings.ToLower(w.Kind), w.Name, w.Namespace, w.Ready, w.Desired)
+}
+
+func PrintTraefikRouter(r *TraefikRouter, indent int) {
+	fmt.Printf("%v-> router: %s\n", strings.Repeat(" ", indent), r.Name)
+	fmt.Printf("%v   rule: %s\n", strings.Repeat(" ", indent), r.Rule)
+	fmt.Printf("%v   service: %s\n", strings.Repeat(" ", indent), r.Service)
+	fmt.Printf("%v   status: %s\n", strings.Repeat(" ", indent), r.Status)
+	for _, e := range r.Errors {
+		fmt.Printf("%v   error: %s\n", strings.Repeat(" ", indent), e)
+	}
+}
+
+func PrintClusterDnsAnswer(p *PodPort, q *ClusterDnsQuery, answers []net.IP, indent int) {
+	fmt.Printf("%v-> %s via %s\n", strings.Repeat(" ", indent), q.Name, p.PodName)
+	fmt.Printf("%v   answers: %s\n", strings.Repeat(" ", indent), joinIPs(answers))
+	fmt.Printf("%v   expected: %s\n", strings.Repeat(" ", indent), joinIPs(q.Expected))
+}
+
+func PrintPodToPodProbe(pr *PodToPodProbe, indent int) {
+	result := "reachable"
+	if !pr.Reachable {
+		result = "unreachable"
+	}
+	fmt.Printf("%v%s %s -> %s\n", strings.Repeat(" ", indent), pr.Layer, pr.Destination, result)
+	if pr.Output != "" && !pr.Reachable {
+		fmt.Printf("%v   %s\n", strings.Repeat(" ", indent), strings.Replace(pr.Output, "\n", "\n"+strings.Repeat(" ", indent+3), -1))
+	}
+}
+
+func PrintServiceEndpoint(e *ServiceEndpoint, indent int) {
+	fmt.Printf("%v-> endpoint: %s (%s)\n", strings.Repeat(" ", indent), net.JoinHostPort(e.IpAddress.String(), fmt.Sprintf("%d", e.Port)), e.State())
+	if e.PodName != "" {
+		fmt.Printf("%v   pod: %s\n", strings.Repeat(" ", indent), e.PodName)
+	}
+	if e.NodeName != "" {
+		fmt.Printf("%v   node: %s\n", strings.Repeat(" ", indent), e.NodeName)
+	}
+}
+
+// externalTrafficPolicy explains what the pods see as the client address, which pod level allowlists match on.
+func externalTrafficPolicy(policy string) string {
+	switch policy {
+	case string(v1.ServiceExternalTrafficPolicyTypeLocal):
+		return "Local, pods see the client IP"
+	case string(v1.ServiceExternalTrafficPolicyTypeCluster):
+		return "Cluster, pods see node IPs rather than the client IP"
+	}
+	return "none"
+}
+
+func ingressKind(i *IngressPath) string {
+	if i.Kind == "" {
+		return "ingress"
+	}
+	return i.Kind
+}
+
+func targetPort(t *Target) string {
+	if t.PortName != "" {
+		return t.PortName
+	}
+	return fmt.Sprintf("%d", t.Port)
+}
+
+func joinIPs(ipAddresses []net.IP) string {
+	var addresses []string
+	for _, ip := range ipAddresses {
+		addresses = append(addresses, ip.String())
+	}
+	return strings.Join(addresses, ", ")
+}
+
+func formatDnsRecord(r *DnsRecord) string {
+	if r.Type == "override" {
+		return fmt.Sprintf("%s %s (--resolve override)", r.Name, r.IpAddress)
+	}
+	if r.Ttl == 0 {
+		return fmt.Sprintf("%s %s %s (ttl unknown)", r.Name, r.Type, r.IpAddress)
+	}
+	return fmt.Sprintf("%s %s %s (ttl %ds)", r.Name, r.Type, r.IpAddress, r.Ttl)
 }
@@ -0,0 +1,337 @@
+package netkat
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/net/http2"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// ResolveOverride pins a host and port to addresses, like curl's --resolve host:port:address[,address].
+	ResolveOverride struct {
+		Host        string
+		Port        int32
+		IpAddresses []net.IP
+	}
+
+	// PortProbe checks that something is serving on an address. A TCP connect is the baseline, the other
+	// protocols also check the server speaks the protocol.
+	PortProbe struct {
+		Protocol string
+		// Host is sent as the Host header and TLS server name of http, https and grpc probes.
+		Host string
+		Path string
+		// Send and Expect are the payload written by raw probes and the text expected in the reply.
+		Send   string
+		Expect string
+	}
+)
+
+const (
+	ProbeTcp   = "tcp"
+	ProbeHttp  = "http"
+	ProbeHttps = "https"
+	ProbeGrpc  = "grpc"
+	ProbeRaw   = "raw"
+	// ProbeH2c speaks HTTP/2 without TLS from the first byte, as servers with the kubernetes.io/h2c appProtocol do.
+	ProbeH2c = "h2c"
+
+	appProtocolH2c = "kubernetes.io/h2c"
+
+	probeTimeout = 10 * time.Second
+	// grpcHealthCheck is the gRPC health checking protocol method, see grpc/health/v1/health.proto.
+	grpcHealthCheck = "/grpc.health.v1.Health/Check"
+)
+
+var (
+	grpcServingStatus = map[uint64]string{0: "UNKNOWN", 1: "SERVING", 2: "NOT_SERVING", 3: "SERVICE_UNKNOWN"}
+)
+
+func ParseResolveOverride(value string) (override *ResolveOverride, err error) {
+	parts := strings.SplitN(value, ":", 3)
+	if len(parts) != 3 {
+		err = fmt.Errorf("invalid --resolve '%s', expected host:port:address", value)
+		return
+	}
+	port, err := strconv.ParseInt(parts[1], 10, 32)
+	if err != nil {
+		err = fmt.Errorf("invalid --resolve port '%s': %v", parts[1], err)
+		return
+	}
+	override = &ResolveOverride{Host: strings.ToLower(parts[0]), Port: int32(port)}
+	for _, address := range strings.Split(parts[2], ",") {
+		ip := net.ParseIP(strings.Trim(address, "[]"))
+		if ip == nil {
+			err = fmt.Errorf("invalid --resolve address '%s'", address)
+			return
+		}
+		override.IpAddresses = append(override.IpAddresses, ip)
+	}
+	return
+}
+
+func (o *ResolveOverride) Matches(host string, port int32) bool {
+	return strings.EqualFold(o.Host, host) && o.Port == port
+}
+
+func (o *ResolveOverride) Records() (records []*DnsRecord) {
+	for _, ip := range o.IpAddresses {
+		records = append(records, &DnsRecord{Name: o.Host, Type: "override", IpAddress: ip})
+	}
+	return
+}
+
+// HttpClient returns a client that always connects to the target's traced address, while sending the target
+// host as the Host header and TLS server name. This lets hosts be probed before DNS points at them.
+func (t *Target) HttpClient() *http.Client {
+	dialer := &net.Dialer{Timeout: probeTimeout}
+	address := net.JoinHostPort(t.IpAddress.String(), strconv.Itoa(int(t.Port)))
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+		TLSClientConfig: &tls.Config{ServerName: t.Host},
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   probeTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Probe sends a request for the target URL to the target's traced address.
+func (t *Target) Probe() (response *http.Response, err error) {
+	if t.Scheme != "http" && t.Scheme != "https" {
+		err = errors.New("only http and https hosts can be probed")
+		return
+	}
+	host := t.Host
+	if !(t.Scheme == "http" && t.Port == 80) && !(t.Scheme == "https" && t.Port == 443) {
+		host = net.JoinHostPort(t.Host, strconv.Itoa(int(t.Port)))
+	}
+	rawUrl := fmt.Sprintf("%s://%s%s", t.Scheme, host, t.Path)
+	response, err = t.HttpClient().Get(rawUrl)
+	if err != nil {
+		return
+	}
+	err = response.Body.Close()
+	return
+}
+
+// ProbeProtocolFor maps a url scheme, a service appProtocol or a port name such as http-metrics or grpc-api to the
+// protocol used to probe it. grpcs is probed as grpc, which tries TLS before cleartext.
+func ProbeProtocolFor(name string) (protocol string, ok bool) {
+	if strings.ToLower(name) == appProtocolH2c {
+		return ProbeH2c, true
+	}
+	prefix := strings.SplitN(strings.ToLower(name), "-", 2)[0]
+	switch prefix {
+	case ProbeTcp, ProbeHttp, ProbeHttps, ProbeGrpc, ProbeRaw, ProbeH2c:
+		return prefix, true
+	case "grpcs":
+		return ProbeGrpc, true
+	}
+	return
+}
+
+// Run probes the address, returning a short description of what answered.
+func (pr *PortProbe) Run(address string) (result string, err error) {
+	switch pr.Protocol {
+	case ProbeHttp, ProbeHttps, ProbeH2c:
+		return pr.runHttp(address)
+	case ProbeGrpc:
+		return pr.runGrpc(address)
+	case ProbeRaw:
+		return pr.runRaw(address)
+	case ProbeTcp, "":
+		var conn net.Conn
+		conn, err = net.DialTimeout("tcp", address, probeTimeout)
+		if err != nil {
+			return
+		}
+		result = "tcp connection accepted"
+		err = conn.Close()
+		return
+	}
+	err = fmt.Errorf("unsupported probe protocol '%s'", pr.Protocol)
+	return
+}
+
+func (pr *PortProbe) host(address string) string {
+	if pr.Host != "" {
+		return pr.Host
+	}
+	return address
+}
+
+// runHttp treats any response as listening, the route checks are only interested in whether the port serves http.
+func (pr *PortProbe) runHttp(address string) (result string, err error) {
+	client := &http.Client{
+		Transport: pr.httpTransport(address, pr.Protocol == ProbeHttps),
+		Timeout:   probeTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	scheme := pr.Protocol
+	if scheme == ProbeH2c {
+		scheme = ProbeHttp
+	}
+	response, err := client.Get(fmt.Sprintf("%s://%s%s", scheme, pr.host(address), pr.Path))
+	if err != nil {
+		return
+	}
+	result = response.Status
+	err = response.Body.Close()
+	return
+}
+
+// httpTransport connects to the address whatever the request host. h2c and gRPC probes speak HTTP/2, over TLS
+// negotiated with ALPN or in cleartext with prior knowledge.
+func (pr *PortProbe) httpTransport(address string, overTls bool) http.RoundTripper {
+	dialer := &net.Dialer{Timeout: probeTimeout}
+	// Pods are probed through a port-forward, so the certificate won't match the address.
+	tlsConfig := &tls.Config{ServerName: pr.Host, InsecureSkipVerify: true}
+	switch {
+	case pr.Protocol == ProbeGrpc && overTls:
+		tlsConfig.NextProtos = []string{http2.NextProtoTLS}
+		return &http2.Transport{
+			DialTLS: func(network string, _ string, _ *tls.Config) (net.Conn, error) {
+				return tls.DialWithDialer(dialer, network, address, tlsConfig)
+			},
+		}
+	case pr.Protocol == ProbeGrpc, pr.Protocol == ProbeH2c:
+		return &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network string, _ string, _ *tls.Config) (net.Conn, error) {
+				return dialer.Dial(network, address)
+			},
+		}
+	}
+	return &http.Transport{
+		DialContext: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+		TLSClientConfig: tlsConfig,
+	}
+}
+
+// grpcOverTls reports whether the server completes a TLS handshake negotiating HTTP/2, as gRPC over TLS does.
+func (pr *PortProbe) grpcOverTls(address string) bool {
+	dialer := &net.Dialer{Timeout: probeTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: pr.Host, InsecureSkipVerify: true, NextProtos: []string{http2.NextProtoTLS}})
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	return conn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS
+}
+
+// runGrpc calls the standard gRPC health service, over TLS when the server negotiates HTTP/2 in a TLS handshake
+// and over cleartext HTTP/2 otherwise. Servers without the health service still prove they speak gRPC, so an
+// unimplemented method counts as listening.
+func (pr *PortProbe) runGrpc(address string) (result string, err error) {
+	overTls := pr.grpcOverTls(address)
+	scheme := "http"
+	if overTls {
+		scheme = "https"
+	}
+	client := &http.Client{Transport: pr.httpTransport(address, overTls), Timeout: probeTimeout}
+	// An empty HealthCheckRequest, framed as an uncompressed message with a zero length.
+	request, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s://%s%s", scheme, pr.host(address), grpcHealthCheck), bytes.NewReader(make([]byte, 5)))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/grpc")
+	request.Header.Set("TE", "trailers")
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return
+	}
+	grpcStatus := response.Trailer.Get("Grpc-Status")
+	if grpcStatus == "" {
+		grpcStatus = response.Header.Get("Grpc-Status")
+	}
+	switch grpcStatus {
+	case "0":
+	case "12":
+		result = "grpc server without the health service"
+		return
+	default:
+		err = fmt.Errorf("grpc health check failed with status %s: %s", grpcStatus, response.Header.Get("Grpc-Message"))
+		return
+	}
+	status := grpcServingStatus[grpcHealthStatus(body)]
+	if status != "SERVING" {
+		err = fmt.Errorf("grpc health check returned %s", status)
+		return
+	}
+	result = "grpc health " + status
+	return
+}
+
+// grpcHealthStatus reads the status field of a framed HealthCheckResponse, which is its only field.
+func grpcHealthStatus(body []byte) uint64 {
+	if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) > len(body)-5 {
+		return 0
+	}
+	message := body[5 : 5+binary.BigEndian.Uint32(body[1:5])]
+	if len(message) < 2 || message[0] != 0x08 {
+		return 0
+	}
+	status, _ := binary.Uvarint(message[1:])
+	return status
+}
+
+func (pr *PortProbe) runRaw(address string) (result string, err error) {
+	conn, err := net.DialTimeout("tcp", address, probeTimeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(probeTimeout))
+	if err != nil {
+		return
+	}
+	if pr.Send != "" {
+		_, err = io.WriteString(conn, pr.Send)
+		if err != nil {
+			return
+		}
+	}
+	if pr.Expect == "" {
+		result = "tcp connection accepted"
+		return
+	}
+	var received []byte
+	buffer := make([]byte, 4096)
+	for !bytes.Contains(received, []byte(pr.Expect)) {
+		var n int
+		n, err = conn.Read(buffer)
+		received = append(received, buffer[:n]...)
+		if err != nil {
+			err = fmt.Errorf("expected '%s' but received '%s': %v", pr.Expect, received, err)
+			return
+		}
+	}
+	result = fmt.Sprintf("received '%s'", pr.Expect)
+	return
+}
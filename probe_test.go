@@ -0,0 +1,143 @@
+package netkat_test
+
+import (
+	"bufio"
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+type (
+	ProbeProtocolTest struct {
+		Name     string
+		Protocol string
+		Ok       bool
+	}
+
+	PodProbeTest struct {
+		RawTarget   string
+		AppProtocol string
+		PortName    string
+		Ingress     bool
+		Expected    string
+	}
+)
+
+var (
+	ProbeProtocolTests = []ProbeProtocolTest{
+		{"http", "http", true},
+		{"http-metrics", "http", true},
+		{"HTTPS", "https", true},
+		{"grpc-api", "grpc", true},
+		{"grpcs", "grpc", true},
+		{"kubernetes.io/h2c", "h2c", true},
+		{"tcp", "tcp", true},
+		{"postgresql", "", false},
+		{"", "", false},
+	}
+
+	PodProbeTests = []PodProbeTest{
+		{"svc/db.default:5432", "", "postgres", false, "tcp"},
+		{"svc/web.default:80", "", "http-web", false, "http"},
+		{"svc/api.default:50051", "grpc", "api", false, "grpc"},
+		{"grpc://api.default.svc.cluster.local:50051", "", "http", false, "grpc"},
+		{"https://grafana.example.com", "", "http", true, "http"},
+		{"https://grafana.example.com", "", "grafana", true, "tcp"},
+	}
+)
+
+func (s *StoreSuite) TestProbeProtocolFor() {
+	for _, test := range ProbeProtocolTests {
+		protocol, ok := netkat.ProbeProtocolFor(test.Name)
+		assert.Equal(s.T(), test.Protocol, protocol, test.Name)
+		assert.Equal(s.T(), test.Ok, ok, test.Name)
+	}
+}
+
+func (s *StoreSuite) TestPodProbe() {
+	for _, test := range PodProbeTests {
+		override, _ := netkat.ParseResolveOverride("grafana.example.com:443:203.0.113.10")
+		ch := netkat.Checker{ResolveOverrides: []*netkat.ResolveOverride{override}}
+		err := ch.ParseTarget(test.RawTarget)
+		if err != nil {
+			s.T().Fatal(err)
+		}
+		ch.KubernetesRoute = &netkat.KubernetesRoute{Service: &netkat.ServicePort{AppProtocol: test.AppProtocol, SourcePortName: test.PortName}}
+		if test.Ingress {
+			ch.KubernetesRoute.Ingress = &netkat.IngressPath{IngressName: "grafana", Namespace: "metrics"}
+		}
+		assert.Equal(s.T(), test.Expected, ch.PodProbe(&netkat.PodPort{}).Protocol, test.RawTarget)
+	}
+	var ch netkat.Checker
+	_ = ch.ParseTarget("svc/web.default:80")
+	ch.Probe = &netkat.PortProbe{Protocol: netkat.ProbeTcp}
+	ch.KubernetesRoute = &netkat.KubernetesRoute{Service: &netkat.ServicePort{SourcePortName: "http"}}
+	assert.Equal(s.T(), netkat.ProbeTcp, ch.PodProbe(&netkat.PodPort{}).Protocol, "Expected --probe to win over the port name")
+}
+
+func (s *StoreSuite) TestPortProbeTcpAndRaw() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			if strings.TrimSpace(line) == "PING" {
+				_, _ = conn.Write([]byte("+PONG\r\n"))
+			}
+			_ = conn.Close()
+		}
+	}()
+	_, err = (&netkat.PortProbe{Protocol: netkat.ProbeTcp}).Run(listener.Addr().String())
+	assert.Nil(s.T(), err)
+	result, err := (&netkat.PortProbe{Protocol: netkat.ProbeRaw, Send: "PING\r\n", Expect: "PONG"}).Run(listener.Addr().String())
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "received 'PONG'", result)
+	_, err = (&netkat.PortProbe{Protocol: netkat.ProbeRaw, Send: "QUIT\r\n", Expect: "PONG"}).Run(listener.Addr().String())
+	assert.NotNil(s.T(), err)
+}
+
+func (s *StoreSuite) TestPortProbeHttpAndGrpc() {
+	grpcHealthHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/grpc.health.v1.Health/Check" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		// A framed HealthCheckResponse{status: SERVING}.
+		_, _ = w.Write([]byte{0, 0, 0, 0, 2, 0x08, 0x01})
+		w.Header().Set("Grpc-Status", "0")
+	})
+	server := httptest.NewServer(h2c.NewHandler(grpcHealthHandler, &http2.Server{}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+	result, err := (&netkat.PortProbe{Protocol: netkat.ProbeHttp, Path: "/"}).Run(address)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "404 Not Found", result)
+	result, err = (&netkat.PortProbe{Protocol: netkat.ProbeH2c, Path: "/"}).Run(address)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "404 Not Found", result)
+	result, err = (&netkat.PortProbe{Protocol: netkat.ProbeGrpc}).Run(address)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "grpc health SERVING", result)
+
+	tlsServer := httptest.NewUnstartedServer(grpcHealthHandler)
+	tlsServer.EnableHTTP2 = true
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	result, err = (&netkat.PortProbe{Protocol: netkat.ProbeGrpc}).Run(strings.TrimPrefix(tlsServer.URL, "https://"))
+	assert.Nil(s.T(), err, "Expected grpc over tls to be probed")
+	assert.Equal(s.T(), "grpc health SERVING", result)
+}
@@ -0,0 +1,354 @@
+package netkat
+
+import (
+	"fmt"
+	"github.com/go-kit/kit/log/level"
+	"io"
+	"io/ioutil"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type (
+	// SourceRangeVerdict is whether the originating IP may reach a resource restricted to source ranges.
+	SourceRangeVerdict struct {
+		OriginIp net.IP
+		// Ranges is empty when the resource is open to every address.
+		Ranges  []*net.IPNet
+		Allowed bool
+		// Match is the first range containing the originating IP.
+		Match *net.IPNet
+	}
+
+	// SourceRangeRule is one list of ranges an ingress controller matches the client address against.
+	SourceRangeRule struct {
+		Description string
+		Ranges      []string
+		Deny        bool
+		// ForwardedFor is set when the rule takes the client address from X-Forwarded-For.
+		ForwardedFor bool
+	}
+
+	// IngressSourceRangeVerdict is whether the ingress controller lets the originating IP through its rules.
+	IngressSourceRangeVerdict struct {
+		OriginIp net.IP
+		Allowed  bool
+		Reasons  []string
+	}
+)
+
+const (
+	// SourceRangesAnnotation is the legacy form of loadBalancerSourceRanges, ignored when the field is set.
+	SourceRangesAnnotation     = "service.beta.kubernetes.io/load-balancer-source-ranges"
+	SourceRangesFromSpec       = "spec.loadBalancerSourceRanges"
+	SourceRangesFromAnnotation = "annotation " + SourceRangesAnnotation
+
+	nginxWhitelistAnnotation = "nginx.ingress.kubernetes.io/whitelist-source-range"
+	nginxAllowlistAnnotation = "nginx.ingress.kubernetes.io/allowlist-source-range"
+	nginxDenylistAnnotation  = "nginx.ingress.kubernetes.io/denylist-source-range"
+
+	IngressControllerNginx   = "nginx"
+	IngressControllerTraefik = "traefik"
+
+	DefaultOriginIpUrl = "https://checkip.amazonaws.com"
+	originIpTimeout    = 10 * time.Second
+)
+
+// ServiceSourceRanges returns the source ranges Kubernetes applies to the service and where they were set.
+func ServiceSourceRanges(specRanges []string, annotations map[string]string) (ranges []string, from string) {
+	if len(specRanges) > 0 {
+		return specRanges, SourceRangesFromSpec
+	}
+	if value, ok := annotations[SourceRangesAnnotation]; ok && strings.TrimSpace(value) != "" {
+		return SplitSourceRanges(value), SourceRangesFromAnnotation
+	}
+	return
+}
+
+// SplitSourceRanges splits a comma separated list of CIDRs, as used by the annotations.
+func SplitSourceRanges(value string) (ranges []string) {
+	for _, r := range strings.Split(value, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			ranges = append(ranges, r)
+		}
+	}
+	return
+}
+
+// ParseSourceRanges parses CIDRs, treating bare addresses as single hosts.
+func ParseSourceRanges(ranges []string) (ipNets []*net.IPNet, err error) {
+	for _, r := range ranges {
+		var ipNet *net.IPNet
+		ipNet, err = parseAddressOrCidr(r)
+		if err != nil {
+			err = fmt.Errorf("invalid source range '%s'", r)
+			return
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return
+}
+
+// EvaluateSourceRanges decides whether the originating IP is inside the ranges. No ranges allows every address.
+func EvaluateSourceRanges(ranges []*net.IPNet, originIp net.IP) (verdict *SourceRangeVerdict) {
+	verdict = &SourceRangeVerdict{OriginIp: originIp, Ranges: ranges, Allowed: len(ranges) == 0}
+	for _, r := range ranges {
+		if r.Contains(originIp) {
+			verdict.Allowed = true
+			verdict.Match = r
+			return
+		}
+	}
+	return
+}
+
+// DiscoverOriginIp asks a what-is-my-IP endpoint, which answers with the caller's address as plain text, for the
+// address traffic from this host leaves through.
+func DiscoverOriginIp(endpoint string) (ip net.IP, err error) {
+	client := http.Client{Timeout: originIpTimeout}
+	response, err := client.Get(endpoint)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("'%s' returned %s", endpoint, response.Status)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	if err != nil {
+		return
+	}
+	ip = net.ParseIP(strings.TrimSpace(string(body)))
+	if ip == nil {
+		err = fmt.Errorf("'%s' did not return an ip address", endpoint)
+	}
+	return
+}
+
+// OriginIp returns the --origin-ip address, or discovers it from the --origin-ip-url endpoint once.
+func (ch *Checker) OriginIp() (ip net.IP, err error) {
+	if ch.Origin != nil {
+		return ch.Origin, nil
+	}
+	endpoint := ch.OriginIpUrl
+	if endpoint == "" {
+		endpoint = DefaultOriginIpUrl
+	}
+	ip, err = DiscoverOriginIp(endpoint)
+	if err != nil {
+		err = fmt.Errorf("could not discover the originating ip, set --origin-ip: %v", err)
+		return
+	}
+	ch.Origin = ip
+	return
+}
+
+// FindLoadBalancerServicePorts finds the LoadBalancer services traffic to the target enters the cluster through:
+// the route's service, or for hosts the service, often an ingress controller's, exposing a resolved address.
+func (co *KubernetesComponents) FindLoadBalancerServicePorts(t *Target, routeService *ServicePort) (servicePorts []*ServicePort) {
+	if routeService != nil && routeService.Type == string(v1.ServiceTypeLoadBalancer) {
+		servicePorts = append(servicePorts, routeService)
+	}
+	if t.Kind != HostTarget {
+		return
+	}
+	for _, s := range co.ServicePorts {
+		if s == routeService || s.Type != string(v1.ServiceTypeLoadBalancer) || s.SourcePort != t.Port {
+			continue
+		}
+		for _, r := range t.Records {
+			if r.IpAddress.Equal(s.ExternalIP) {
+				servicePorts = append(servicePorts, s)
+				break
+			}
+		}
+	}
+	return
+}
+
+// IngressControllerFor names the controller serving the ingress path from its IngressClass, class name and
+// annotations.
+func IngressControllerFor(i *IngressPath) string {
+	switch {
+	case i.Kind == IngressRouteKind:
+		return IngressControllerTraefik
+	case strings.Contains(i.IngressClassController, IngressControllerTraefik):
+		return IngressControllerTraefik
+	case strings.Contains(i.IngressClassController, IngressControllerNginx):
+		return IngressControllerNginx
+	case strings.Contains(i.IngressClassName, IngressControllerTraefik):
+		return IngressControllerTraefik
+	case strings.Contains(i.IngressClassName, IngressControllerNginx):
+		return IngressControllerNginx
+	}
+	for annotation := range i.Annotations {
+		switch {
+		case strings.HasPrefix(annotation, "traefik.ingress.kubernetes.io/"):
+			return IngressControllerTraefik
+		case strings.HasPrefix(annotation, "nginx.ingress.kubernetes.io/"):
+			return IngressControllerNginx
+		}
+	}
+	return ""
+}
+
+// IngressSourceRangeRules collects the source range annotations of the ingress path and the IP allow lists of
+// the Traefik middlewares it references. allowlist-source-range is the newer name of whitelist-source-range and
+// ingress-nginx only reads one of them, preferring allowlist. Middlewares which can't be resolved are skipped.
+func (co *KubernetesComponents) IngressSourceRangeRules(i *IngressPath) (rules []*SourceRangeRule) {
+	allowAnnotation := nginxAllowlistAnnotation
+	if strings.TrimSpace(i.Annotations[allowAnnotation]) == "" {
+		allowAnnotation = nginxWhitelistAnnotation
+	}
+	for _, annotation := range []string{nginxDenylistAnnotation, allowAnnotation} {
+		if value, ok := i.Annotations[annotation]; ok && strings.TrimSpace(value) != "" {
+			rules = append(rules, &SourceRangeRule{
+				Description: "annotation " + annotation,
+				Ranges:      SplitSourceRanges(value),
+				Deny:        annotation == nginxDenylistAnnotation,
+			})
+		}
+	}
+	for _, ref := range SplitSourceRanges(i.Annotations[traefikMiddlewaresAnnotation]) {
+		middleware, err := co.FindMiddleware(ref)
+		if err != nil {
+			_ = level.Error(Logger).Log("msg", fmt.Sprintf("%v, skipping it for ingress %s.%s", err, i.IngressName, i.Namespace))
+			continue
+		}
+		allowList := middleware.AllowList()
+		if allowList == nil {
+			continue
+		}
+		rules = append(rules, &SourceRangeRule{
+			Description:  fmt.Sprintf("middleware %s/%s", middleware.Namespace, middleware.Name),
+			Ranges:       allowList.SourceRange,
+			ForwardedFor: allowList.IPStrategy != nil && (allowList.IPStrategy.Depth > 0 || len(allowList.IPStrategy.ExcludedIPs) > 0),
+		})
+	}
+	return
+}
+
+// ControllerClientAddress decides whether the controller sees the originating IP as the client address. Without
+// proxy protocol or trusted X-Forwarded-For headers it sees the connection's address, which is only the client's
+// when the controller's LoadBalancer service keeps it with externalTrafficPolicy Local.
+func ControllerClientAddress(controller string, args []string, nginxConfig map[string]string, lb *ServicePort) (seesOriginIp bool, reason string) {
+	switch controller {
+	case IngressControllerNginx:
+		if nginxConfig["use-proxy-protocol"] == "true" {
+			return true, "ingress-nginx reads the client address from the proxy protocol header"
+		}
+		if nginxConfig["use-forwarded-headers"] == "true" {
+			return true, "ingress-nginx trusts the X-Forwarded-For header from the load balancer"
+		}
+	case IngressControllerTraefik:
+		for _, arg := range args {
+			lower := strings.ToLower(arg)
+			if strings.Contains(lower, ".proxyprotocol.") {
+				return true, "traefik entry points read the client address from the proxy protocol header"
+			}
+			if strings.Contains(lower, ".forwardedheaders.") {
+				return true, "traefik entry points trust the X-Forwarded-For header"
+			}
+		}
+	}
+	if lb == nil {
+		return true, "no LoadBalancer service was found in front of the controller, clients are assumed to connect directly"
+	}
+	if lb.ExternalTrafficPolicy == string(v1.ServiceExternalTrafficPolicyTypeLocal) {
+		return true, fmt.Sprintf("service %s.%s keeps the client address with externalTrafficPolicy Local", lb.ServiceName, lb.Namespace)
+	}
+	return false, fmt.Sprintf(
+		"service %s.%s has externalTrafficPolicy %s, so the controller sees node addresses rather than the client's, "+
+			"set externalTrafficPolicy Local or enable proxy protocol", lb.ServiceName, lb.Namespace, lb.ExternalTrafficPolicy)
+}
+
+// EvaluateIngressSourceRanges decides whether the controller lets the originating IP through every rule. Deny
+// lists win over allow lists, and every allow list, one per chained middleware, must contain the address. When the
+// controller can't see the originating IP, allow lists matching the connection's address fail and deny lists
+// aren't evaluated, as node addresses never match them.
+func EvaluateIngressSourceRanges(rules []*SourceRangeRule, originIp net.IP, seesOriginIp bool) (verdict *IngressSourceRangeVerdict, err error) {
+	verdict = &IngressSourceRangeVerdict{OriginIp: originIp, Allowed: true}
+	for _, rule := range rules {
+		var ranges []*net.IPNet
+		ranges, err = ParseSourceRanges(rule.Ranges)
+		if err != nil {
+			err = fmt.Errorf("%s has %v", rule.Description, err)
+			return
+		}
+		if !seesOriginIp && !rule.ForwardedFor {
+			if rule.Deny {
+				verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("%s not evaluated, it is matched against node addresses, not %s", rule.Description, originIp))
+				continue
+			}
+			verdict.Allowed = false
+			verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("%s is matched against node addresses, not %s", rule.Description, originIp))
+			continue
+		}
+		match := EvaluateSourceRanges(ranges, originIp).Match
+		switch {
+		case rule.Deny && match != nil:
+			verdict.Allowed = false
+			verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("denied by %s (%s)", rule.Description, match))
+		case rule.Deny:
+			verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("not in %s", rule.Description))
+		case match != nil:
+			verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("allowed by %s (%s)", rule.Description, match))
+		default:
+			verdict.Allowed = false
+			verdict.Reasons = append(verdict.Reasons, fmt.Sprintf("denied, outside %s (%s)", rule.Description, strings.Join(rule.Ranges, ", ")))
+		}
+	}
+	return
+}
+
+// FindControllerLoadBalancer finds the LoadBalancer service in front of the controller pods, preferring the one
+// exposing the target's resolved address.
+func (co *KubernetesComponents) FindControllerLoadBalancer(t *Target, pods []*PodPort) *ServicePort {
+	for _, s := range co.FindLoadBalancerServicePorts(t, nil) {
+		for _, p := range pods {
+			if s.SelectsPod(p) {
+				return s
+			}
+		}
+	}
+	for _, s := range co.ServicePorts {
+		if s.Type != string(v1.ServiceTypeLoadBalancer) {
+			continue
+		}
+		for _, p := range pods {
+			if s.SelectsPod(p) {
+				return s
+			}
+		}
+	}
+	return nil
+}
+
+// IngressNginxConfig reads the ConfigMap ingress-nginx takes its settings from, named by its --configmap flag.
+func (c *Client) IngressNginxConfig(pods []*PodPort) (config map[string]string, err error) {
+	for _, p := range pods {
+		ref := argValue(p.Args, "--configmap")
+		if ref == "" {
+			continue
+		}
+		ref = strings.Replace(ref, "$(POD_NAMESPACE)", p.Namespace, 1)
+		parts := strings.SplitN(ref, "/", 2)
+		if len(parts) != 2 {
+			err = fmt.Errorf("invalid ingress-nginx --configmap '%s'", ref)
+			return
+		}
+		var configMap *v1.ConfigMap
+		configMap, err = c.CoreV1().ConfigMaps(parts[0]).Get(parts[1], metav1.GetOptions{})
+		if err != nil {
+			return
+		}
+		config = configMap.Data
+		return
+	}
+	return
+}
@@ -0,0 +1,168 @@
+package netkat_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+)
+
+type (
+	ServiceSourceRangesTest struct {
+		SpecRanges  []string
+		Annotations map[string]string
+		Expected    []string
+		From        string
+	}
+
+	SourceRangesTest struct {
+		Ranges   []string
+		OriginIp string
+		Allowed  bool
+	}
+)
+
+var (
+	ServiceSourceRangesTests = []ServiceSourceRangesTest{
+		{[]string{"10.0.0.0/8"}, map[string]string{netkat.SourceRangesAnnotation: "192.168.0.0/16"}, []string{"10.0.0.0/8"}, netkat.SourceRangesFromSpec},
+		{nil, map[string]string{netkat.SourceRangesAnnotation: "192.168.0.0/16, 203.0.113.7"}, []string{"192.168.0.0/16", "203.0.113.7"}, netkat.SourceRangesFromAnnotation},
+		{nil, map[string]string{netkat.SourceRangesAnnotation: " "}, nil, ""},
+		{nil, nil, nil, ""},
+	}
+
+	SourceRangesTests = []SourceRangesTest{
+		{[]string{"203.0.113.0/24"}, "203.0.113.7", true},
+		{[]string{"10.0.0.0/8", "203.0.113.7"}, "203.0.113.7", true},
+		{[]string{"10.0.0.0/8"}, "203.0.113.7", false},
+		{[]string{"2001:db8::/32"}, "2001:db8::1", true},
+		{nil, "203.0.113.7", true},
+	}
+)
+
+func (s *StoreSuite) TestServiceSourceRanges() {
+	for _, test := range ServiceSourceRangesTests {
+		ranges, from := netkat.ServiceSourceRanges(test.SpecRanges, test.Annotations)
+		assert.Equal(s.T(), test.Expected, ranges)
+		assert.Equal(s.T(), test.From, from)
+	}
+}
+
+func (s *StoreSuite) TestEvaluateSourceRanges() {
+	for _, test := range SourceRangesTests {
+		ranges, err := netkat.ParseSourceRanges(test.Ranges)
+		if err != nil {
+			s.T().Fatal(err)
+		}
+		verdict := netkat.EvaluateSourceRanges(ranges, net.ParseIP(test.OriginIp))
+		assert.Equal(s.T(), test.Allowed, verdict.Allowed, test.Ranges)
+	}
+	_, err := netkat.ParseSourceRanges([]string{"10.0.0.0/33"})
+	assert.NotNil(s.T(), err)
+}
+
+func (s *StoreSuite) TestDiscoverOriginIp() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, "203.0.113.7")
+	}))
+	defer server.Close()
+	ip, err := netkat.DiscoverOriginIp(server.URL)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "203.0.113.7", ip.String())
+}
+
+func (s *StoreSuite) TestCheckSourceRangesService() {
+	lb := netkat.ServicePort{ServiceName: "web", Namespace: "shop", Type: "LoadBalancer", SourceRanges: []string{"10.0.0.0/8"}, SourceRangesFrom: netkat.SourceRangesFromSpec, SourcePort: 443}
+	OriginTests := []struct {
+		OriginIp string
+		Expected int
+	}{
+		{"10.1.2.3", 1},
+		{"203.0.113.7", 0},
+	}
+	for _, test := range OriginTests {
+		var ch netkat.Checker
+		_ = ch.ParseTarget("svc/web.shop:443")
+		ch.Origin = net.ParseIP(test.OriginIp)
+		ch.KubernetesComponents = &netkat.KubernetesComponents{ServicePorts: []*netkat.ServicePort{&lb}}
+		ch.KubernetesRoute = &netkat.KubernetesRoute{Service: &lb}
+		ch.CheckSourceRangesService()
+		assert.Equal(s.T(), test.Expected, len(ch.PassedChecks), test.OriginIp)
+	}
+}
+
+const MiddlewareListJson = `{"items": [
+  {"metadata": {"name": "office", "namespace": "web"},
+   "spec": {"ipAllowList": {"sourceRange": ["203.0.113.0/24"]}}},
+  {"metadata": {"name": "vpn", "namespace": "web"},
+   "spec": {"ipWhiteList": {"sourceRange": ["198.51.100.0/24"], "ipStrategy": {"depth": 1}}}},
+  {"metadata": {"name": "headers", "namespace": "web"},
+   "spec": {}}
+]}`
+
+type (
+	IngressSourceRangesTest struct {
+		Annotations  map[string]string
+		OriginIp     string
+		SeesOriginIp bool
+		Allowed      bool
+	}
+
+	ControllerClientAddressTest struct {
+		Controller   string
+		Args         []string
+		NginxConfig  map[string]string
+		Policy       string
+		SeesOriginIp bool
+	}
+)
+
+var (
+	IngressSourceRangesTests = []IngressSourceRangesTest{
+		{map[string]string{"nginx.ingress.kubernetes.io/whitelist-source-range": "10.0.0.0/8, 203.0.113.0/24"}, "203.0.113.7", true, true},
+		{map[string]string{"nginx.ingress.kubernetes.io/allowlist-source-range": "10.0.0.0/8"}, "203.0.113.7", true, false},
+		{map[string]string{"nginx.ingress.kubernetes.io/whitelist-source-range": "203.0.113.0/24", "nginx.ingress.kubernetes.io/denylist-source-range": "203.0.113.7"}, "203.0.113.7", true, false},
+		{map[string]string{"nginx.ingress.kubernetes.io/denylist-source-range": "10.0.0.0/8"}, "203.0.113.7", true, true},
+		{map[string]string{"nginx.ingress.kubernetes.io/whitelist-source-range": "203.0.113.0/24"}, "203.0.113.7", false, false},
+		{map[string]string{"nginx.ingress.kubernetes.io/denylist-source-range": "203.0.113.0/24"}, "203.0.113.7", false, true},
+		{map[string]string{"traefik.ingress.kubernetes.io/router.middlewares": "web-office@kubernetescrd,web-headers@kubernetescrd"}, "203.0.113.7", true, true},
+		{map[string]string{"traefik.ingress.kubernetes.io/router.middlewares": "web-office@kubernetescrd,web-vpn@kubernetescrd"}, "203.0.113.7", true, false},
+		{map[string]string{"traefik.ingress.kubernetes.io/router.middlewares": "web-vpn@kubernetescrd"}, "198.51.100.7", false, true},
+		{map[string]string{"nginx.ingress.kubernetes.io/allowlist-source-range": "203.0.113.0/24", "nginx.ingress.kubernetes.io/whitelist-source-range": "10.0.0.0/8"}, "203.0.113.7", true, true},
+		{map[string]string{"traefik.ingress.kubernetes.io/router.middlewares": "web-missing@kubernetescrd,auth@file,web-office@kubernetescrd"}, "203.0.113.7", true, true},
+	}
+
+	ControllerClientAddressTests = []ControllerClientAddressTest{
+		{netkat.IngressControllerNginx, nil, map[string]string{"use-proxy-protocol": "true"}, "Cluster", true},
+		{netkat.IngressControllerNginx, nil, map[string]string{"use-forwarded-headers": "true"}, "Cluster", true},
+		{netkat.IngressControllerNginx, nil, nil, "Cluster", false},
+		{netkat.IngressControllerNginx, nil, nil, "Local", true},
+		{netkat.IngressControllerTraefik, []string{"--entryPoints.websecure.proxyProtocol.trustedIPs=10.0.0.0/8"}, nil, "Cluster", true},
+		{netkat.IngressControllerTraefik, []string{"--entryPoints.websecure.address=:8443"}, nil, "Cluster", false},
+	}
+)
+
+func (s *StoreSuite) TestEvaluateIngressSourceRanges() {
+	var apiMiddlewares netkat.MiddlewareList
+	err := json.Unmarshal([]byte(MiddlewareListJson), &apiMiddlewares)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	components := netkat.KubernetesComponents{Middlewares: apiMiddlewares.Items}
+	for _, test := range IngressSourceRangesTests {
+		rules := components.IngressSourceRangeRules(&netkat.IngressPath{Annotations: test.Annotations})
+		verdict, err := netkat.EvaluateIngressSourceRanges(rules, net.ParseIP(test.OriginIp), test.SeesOriginIp)
+		assert.Nil(s.T(), err)
+		assert.Equal(s.T(), test.Allowed, verdict.Allowed, verdict.Reasons)
+	}
+}
+
+func (s *StoreSuite) TestControllerClientAddress() {
+	for _, test := range ControllerClientAddressTests {
+		lb := netkat.ServicePort{ServiceName: "controller", Namespace: "ingress", Type: "LoadBalancer", ExternalTrafficPolicy: test.Policy}
+		seesOriginIp, reason := netkat.ControllerClientAddress(test.Controller, test.Args, test.NginxConfig, &lb)
+		assert.Equal(s.T(), test.SeesOriginIp, seesOriginIp, reason)
+	}
+}
@@ -0,0 +1,392 @@
+package netkat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log/level"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The Traefik types below mirror the fields netkat reads from the traefik.io/v1alpha1 and the older
+// traefik.containo.us/v1alpha1 CRDs.
+type (
+	IngressRoute struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		Spec              IngressRouteSpec `json:"spec,omitempty"`
+	}
+
+	IngressRouteList struct {
+		GroupVersion string         `json:"-"`
+		Items        []IngressRoute `json:"items"`
+	}
+
+	IngressRouteSpec struct {
+		Routes []Route `json:"routes,omitempty"`
+	}
+
+	Route struct {
+		Match       string          `json:"match"`
+		Services    []RouteService  `json:"services,omitempty"`
+		Middlewares []MiddlewareRef `json:"middlewares,omitempty"`
+	}
+
+	// RouteService is a Kubernetes service, or a TraefikService when Kind says so.
+	RouteService struct {
+		Name string             `json:"name"`
+		Kind string             `json:"kind,omitempty"`
+		Port intstr.IntOrString `json:"port,omitempty"`
+	}
+
+	MiddlewareRef struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace,omitempty"`
+	}
+
+	Middleware struct {
+		metav1.ObjectMeta `json:"metadata,omitempty"`
+		Spec              MiddlewareSpec `json:"spec,omitempty"`
+	}
+
+	MiddlewareList struct {
+		GroupVersion string       `json:"-"`
+		Items        []Middleware `json:"items"`
+	}
+
+	// MiddlewareSpec holds ipAllowList, and ipWhiteList as it was called before Traefik 3.
+	MiddlewareSpec struct {
+		IPAllowList *IPAllowList `json:"ipAllowList,omitempty"`
+		IPWhiteList *IPAllowList `json:"ipWhiteList,omitempty"`
+	}
+
+	IPAllowList struct {
+		SourceRange []string    `json:"sourceRange,omitempty"`
+		IPStrategy  *IPStrategy `json:"ipStrategy,omitempty"`
+	}
+
+	// IPStrategy picks the client address from X-Forwarded-For, by depth from the right or by skipping
+	// excluded addresses, instead of using the connection's remote address.
+	IPStrategy struct {
+		Depth       int      `json:"depth,omitempty"`
+		ExcludedIPs []string `json:"excludedIPs,omitempty"`
+	}
+
+	// TraefikRouter mirrors the fields netkat reads from the routers of the Traefik API.
+	TraefikRouter struct {
+		Name     string   `json:"name"`
+		Rule     string   `json:"rule"`
+		Service  string   `json:"service"`
+		Provider string   `json:"provider"`
+		Status   string   `json:"status"`
+		Errors   []string `json:"error,omitempty"`
+	}
+)
+
+const (
+	IngressRouteKind = "ingressroute"
+
+	traefikMiddlewaresAnnotation = "traefik.ingress.kubernetes.io/router.middlewares"
+	traefikCrdProvider           = "@kubernetescrd"
+	traefikRoutersPath           = "/api/http/routers?per_page=1000"
+	traefikPingPath              = "/ping"
+	traefikRouterEnabled         = "enabled"
+	defaultTraefikApiPort        = 8080
+)
+
+var (
+	// traefikMatchers pick the hosts and paths out of a router rule such as Host(`a`) && PathPrefix(`/b`).
+	traefikMatchers     = regexp.MustCompile("(Host|PathPrefix|Path)\\(([^)]*)\\)")
+	traefikMatcherValue = regexp.MustCompile("`([^`]*)`|\"([^\"]*)\"")
+
+	traefikGroupVersions = []schema.GroupVersion{
+		{Group: "traefik.io", Version: "v1alpha1"},
+		{Group: "traefik.containo.us", Version: "v1alpha1"},
+	}
+)
+
+// TraefikGroupVersion uses the discovery API to find the Traefik CRD group serving the resource.
+func (c *Client) TraefikGroupVersion(resource string) (groupVersion schema.GroupVersion, err error) {
+	groupVersion, ok := c.preferredGroupVersion(traefikGroupVersions, resource)
+	if !ok {
+		err = errors.New("the server does not serve the traefik crds")
+	}
+	return
+}
+
+// GetMiddlewares lists the Traefik middlewares, returning none on clusters without the Traefik CRDs.
+func (c *Client) GetMiddlewares() (apiMiddlewares *MiddlewareList) {
+	apiMiddlewares = &MiddlewareList{}
+	groupVersion, err := c.TraefikGroupVersion("middlewares")
+	if err != nil {
+		return
+	}
+	apiMiddlewares.GroupVersion = groupVersion.String()
+	unstructuredMiddlewares, err := c.Dynamic.Resource(groupVersion.WithResource("middlewares")).List(metav1.ListOptions{})
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		return
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredMiddlewares.UnstructuredContent(), apiMiddlewares)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+	}
+	return
+}
+
+// AllowList returns the middleware's ipAllowList or ipWhiteList.
+func (m *Middleware) AllowList() *IPAllowList {
+	if m.Spec.IPAllowList != nil {
+		return m.Spec.IPAllowList
+	}
+	return m.Spec.IPWhiteList
+}
+
+// FindMiddleware finds a middleware referenced by an ingress in the annotation form namespace-name@kubernetescrd.
+func (co *KubernetesComponents) FindMiddleware(ref string) (middleware *Middleware, err error) {
+	if !strings.HasSuffix(ref, traefikCrdProvider) {
+		err = fmt.Errorf("middleware '%s' is not from the kubernetescrd provider", ref)
+		return
+	}
+	name := strings.TrimSuffix(ref, traefikCrdProvider)
+	for i := range co.Middlewares {
+		m := &co.Middlewares[i]
+		if m.Namespace+"-"+m.Name == name {
+			middleware = m
+			return
+		}
+	}
+	err = fmt.Errorf("could not find middleware '%s'", ref)
+	return
+}
+
+// GetIngressRoutes lists the Traefik IngressRoutes, returning none on clusters without the Traefik CRDs.
+func (c *Client) GetIngressRoutes() (apiIngressRoutes *IngressRouteList) {
+	apiIngressRoutes = &IngressRouteList{}
+	groupVersion, err := c.TraefikGroupVersion("ingressroutes")
+	if err != nil {
+		return
+	}
+	apiIngressRoutes.GroupVersion = groupVersion.String()
+	unstructuredIngressRoutes, err := c.Dynamic.Resource(groupVersion.WithResource("ingressroutes")).List(metav1.ListOptions{})
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+		return
+	}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(unstructuredIngressRoutes.UnstructuredContent(), apiIngressRoutes)
+	if err != nil {
+		_ = level.Error(Logger).Log("msg", err)
+	}
+	return
+}
+
+// IngressRoutesToIngressPaths turns each host and path of the Host(), PathPrefix() and Path() matchers of a
+// route into an IngressPath to its first Kubernetes service. PathPrefix is a string prefix in Traefik, so those
+// paths are left without a path type and matched by the traefik ingress class. Route middlewares are recorded in
+// the router.middlewares annotation form the Ingress provider uses.
+func IngressRoutesToIngressPaths(apiIngressRoutes *IngressRouteList) (ingressPaths []*IngressPath) {
+	for _, ingressRoute := range apiIngressRoutes.Items {
+		className := ingressRoute.ObjectMeta.Annotations[ingressClassAnnotation]
+		if className == "" {
+			className = IngressControllerTraefik
+		}
+		for _, route := range ingressRoute.Spec.Routes {
+			service := route.kubernetesService()
+			if service == nil {
+				continue
+			}
+			annotations := make(map[string]string)
+			for k, v := range ingressRoute.ObjectMeta.Annotations {
+				annotations[k] = v
+			}
+			if middlewares := route.middlewareRefs(ingressRoute.Namespace); middlewares != "" {
+				annotations[traefikMiddlewaresAnnotation] = middlewares
+			}
+			hosts, paths := ParseTraefikRule(route.Match)
+			if len(hosts) == 0 {
+				hosts = []string{""}
+			}
+			if len(paths) == 0 {
+				paths = []*IngressPath{{Path: "/"}}
+			}
+			for _, host := range hosts {
+				for _, path := range paths {
+					ingressPaths = append(
+						ingressPaths,
+						&IngressPath{
+							Kind:             IngressRouteKind,
+							Host:             host,
+							Path:             path.Path,
+							PathType:         path.PathType,
+							IngressClassName: className,
+							Annotations:      annotations,
+							ServiceName:      service.Name,
+							ServiceIntPort:   service.Port.IntVal,
+							ServiceStrPort:   service.Port.StrVal,
+							IngressName:      ingressRoute.ObjectMeta.Name,
+							Namespace:        ingressRoute.ObjectMeta.Namespace,
+						},
+					)
+				}
+			}
+		}
+	}
+	return
+}
+
+// ParseTraefikRule returns the hosts and paths of a router rule. Prefix paths have no path type and Path() paths
+// are Exact.
+func ParseTraefikRule(rule string) (hosts []string, paths []*IngressPath) {
+	for _, matcher := range traefikMatchers.FindAllStringSubmatch(rule, -1) {
+		for _, value := range traefikMatcherValue.FindAllStringSubmatch(matcher[2], -1) {
+			argument := value[1] + value[2]
+			switch matcher[1] {
+			case "Host":
+				hosts = append(hosts, argument)
+			case "PathPrefix":
+				paths = append(paths, &IngressPath{Path: argument})
+			case "Path":
+				paths = append(paths, &IngressPath{Path: argument, PathType: PathTypeExact})
+			}
+		}
+	}
+	return
+}
+
+// kubernetesService returns the first Kubernetes service of the route, the one netkat follows.
+func (r *Route) kubernetesService() *RouteService {
+	for n, service := range r.Services {
+		if service.Kind == "" || service.Kind == "Service" {
+			return &r.Services[n]
+		}
+	}
+	return nil
+}
+
+func (r *Route) middlewareRefs(namespace string) string {
+	var refs []string
+	for _, m := range r.Middlewares {
+		middlewareNamespace := m.Namespace
+		if middlewareNamespace == "" {
+			middlewareNamespace = namespace
+		}
+		refs = append(refs, middlewareNamespace+"-"+m.Name+traefikCrdProvider)
+	}
+	return strings.Join(refs, ",")
+}
+
+// AttachIngressRouteAddresses gives the IngressRoute paths, which have no status, the external addresses of the
+// LoadBalancer services in front of the Traefik pods.
+func (co *KubernetesComponents) AttachIngressRouteAddresses() {
+	pods := co.FindIngressControllerPodPorts(IngressControllerTraefik)
+	var ipAddresses []net.IP
+	var hostnames []string
+	seen := make(map[string]bool)
+	for _, s := range co.ServicePorts {
+		if s.Type != string(v1.ServiceTypeLoadBalancer) || seen[s.Namespace+"/"+s.ServiceName] {
+			continue
+		}
+		for _, p := range pods {
+			if !s.SelectsPod(p) {
+				continue
+			}
+			seen[s.Namespace+"/"+s.ServiceName] = true
+			if s.ExternalIP != nil {
+				ipAddresses = append(ipAddresses, s.ExternalIP)
+			} else if s.ExternalHostname != "" {
+				hostnames = append(hostnames, s.ExternalHostname)
+			}
+			break
+		}
+	}
+	for _, i := range co.IngressPaths {
+		if i.Kind == IngressRouteKind {
+			i.IpAddresses = ipAddresses
+			i.LoadBalancerHostnames = hostnames
+		}
+	}
+}
+
+// FindTraefikPods finds the Traefik pods, one entry per pod.
+func (co *KubernetesComponents) FindTraefikPods() (pods []*PodPort) {
+	return uniquePods(co.FindIngressControllerPodPorts(IngressControllerTraefik))
+}
+
+// TraefikApiPort returns the port of the traefik entry point, which serves the API and ping.
+func TraefikApiPort(p *PodPort) int32 {
+	address := argValue(p.Args, "--entrypoints.traefik.address")
+	address = strings.TrimSuffix(strings.TrimSuffix(address, "/tcp"), "/udp")
+	port, err := strconv.Atoi(address[strings.LastIndex(address, ":")+1:])
+	if err != nil {
+		return defaultTraefikApiPort
+	}
+	return int32(port)
+}
+
+// traefikPingPort returns the port the pod serves /ping on, or 0 when ping isn't enabled.
+func traefikPingPort(p *PodPort) int32 {
+	if !TraefikPingEnabled(p) {
+		return 0
+	}
+	return TraefikApiPort(p)
+}
+
+// TraefikPingEnabled reports whether the pod serves /ping.
+func TraefikPingEnabled(p *PodPort) bool {
+	for _, arg := range p.Args {
+		lower := strings.ToLower(arg)
+		if lower == "--ping" || lower == "--ping=true" || strings.HasPrefix(lower, "--ping.") {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTraefikRouters lists the HTTP routers loaded by the Traefik pod from its API over a port-forward.
+func (c *Client) GetTraefikRouters(p *PodPort) (routers []*TraefikRouter, err error) {
+	response, body, err := c.getThroughForward(p, TraefikApiPort(p), traefikRoutersPath)
+	if err != nil {
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("traefik api returned %s, check the api is enabled with --api", response.Status)
+		return
+	}
+	err = json.Unmarshal(body, &routers)
+	return
+}
+
+// MatchTraefikRouters finds the routers Traefik built for the ingress path. The CRD provider names them after the
+// IngressRoute's namespace and name, the Ingress provider after the Ingress's namespace and name, host and path.
+func MatchTraefikRouters(routers []*TraefikRouter, i *IngressPath) (matches []*TraefikRouter) {
+	prefix, provider := traefikNormalize(i.Namespace+"-"+i.IngressName)+"-", "@kubernetes"
+	if i.Kind == IngressRouteKind {
+		provider = traefikCrdProvider
+	}
+	for _, r := range routers {
+		if !strings.HasSuffix(r.Name, provider) || !strings.HasPrefix(r.Name, prefix) {
+			continue
+		}
+		if i.Host != "" && !strings.Contains(r.Rule, "`"+i.Host+"`") {
+			continue
+		}
+		matches = append(matches, r)
+	}
+	return
+}
+
+// traefikNormalize joins the letters and digits of the name with dashes, as Traefik does for router names.
+func traefikNormalize(name string) string {
+	return strings.Join(strings.FieldsFunc(name, func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+	}), "-")
+}
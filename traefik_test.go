@@ -0,0 +1,121 @@
+package netkat_test
+
+import (
+	"encoding/json"
+	"github.com/stevenayers/netkat"
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	TraefikRuleTest struct {
+		Rule      string
+		Hosts     []string
+		Paths     []string
+		PathTypes []string
+	}
+
+	TraefikRouterTest struct {
+		IngressPath netkat.IngressPath
+		Expected    []string
+	}
+)
+
+const IngressRouteListJson = `{"items": [
+  {"metadata": {"name": "grafana", "namespace": "metrics"},
+   "spec": {"entryPoints": ["websecure"], "routes": [
+     {"match": "Host(` + "`grafana.foobar.com`" + `) && PathPrefix(` + "`/api`" + `)", "kind": "Rule",
+      "middlewares": [{"name": "office"}, {"name": "auth", "namespace": "security"}],
+      "services": [{"name": "grafana-api", "port": 8080}]},
+     {"match": "Host(` + "`grafana.foobar.com`" + `)", "kind": "Rule",
+      "services": [{"name": "grafana", "port": "http"}]},
+     {"match": "Host(` + "`weighted.foobar.com`" + `)", "kind": "Rule",
+      "services": [{"name": "canary", "kind": "TraefikService"}]}
+   ]}}
+]}`
+
+const TraefikRoutersJson = `[
+  {"name": "metrics-grafana-6a8f1c3b2e@kubernetescrd", "rule": "Host(` + "`grafana.foobar.com`" + `)", "service": "metrics-grafana-6a8f1c3b2e", "provider": "kubernetescrd", "status": "enabled"},
+  {"name": "metrics-grafana-api-1b2c3d4e5f@kubernetescrd", "rule": "Host(` + "`other.foobar.com`" + `)", "service": "metrics-grafana-api", "provider": "kubernetescrd", "status": "enabled"},
+  {"name": "shop-web-shop-foobar-com@kubernetes", "rule": "Host(` + "`shop.foobar.com`" + `) && PathPrefix(` + "`/`" + `)", "service": "shop-web-80", "provider": "kubernetes", "status": "disabled", "error": ["the service \"shop-web-80@kubernetes\" does not exist"]}
+]`
+
+var (
+	TraefikRuleTests = []TraefikRuleTest{
+		{"Host(`a.foobar.com`)", []string{"a.foobar.com"}, nil, nil},
+		{"Host(`a.foobar.com`) && PathPrefix(`/api`)", []string{"a.foobar.com"}, []string{"/api"}, []string{""}},
+		{"(Host(`a.foobar.com`) || Host(`b.foobar.com`)) && Path(`/login`)", []string{"a.foobar.com", "b.foobar.com"}, []string{"/login"}, []string{netkat.PathTypeExact}},
+		{"Host(`a.foobar.com`, `b.foobar.com`)", []string{"a.foobar.com", "b.foobar.com"}, nil, nil},
+		{"HostRegexp(`{subdomain:[a-z]+}.foobar.com`)", nil, nil, nil},
+	}
+
+	TraefikRouterTests = []TraefikRouterTest{
+		{netkat.IngressPath{Kind: netkat.IngressRouteKind, IngressName: "grafana", Namespace: "metrics", Host: "grafana.foobar.com"}, []string{"metrics-grafana-6a8f1c3b2e@kubernetescrd"}},
+		{netkat.IngressPath{IngressName: "web", Namespace: "shop", Host: "shop.foobar.com"}, []string{"shop-web-shop-foobar-com@kubernetes"}},
+		{netkat.IngressPath{IngressName: "web", Namespace: "other", Host: "shop.foobar.com"}, nil},
+		{netkat.IngressPath{IngressName: "shop", Namespace: "web", Host: "shop.foobar.com"}, nil},
+	}
+)
+
+func (s *StoreSuite) TestParseTraefikRule() {
+	for _, test := range TraefikRuleTests {
+		hosts, paths := netkat.ParseTraefikRule(test.Rule)
+		assert.Equal(s.T(), test.Hosts, hosts, test.Rule)
+		var pathNames, pathTypes []string
+		for _, p := range paths {
+			pathNames = append(pathNames, p.Path)
+			pathTypes = append(pathTypes, p.PathType)
+		}
+		assert.Equal(s.T(), test.Paths, pathNames, test.Rule)
+		assert.Equal(s.T(), test.PathTypes, pathTypes, test.Rule)
+	}
+}
+
+func (s *StoreSuite) TestIngressRoutesToIngressPaths() {
+	var apiIngressRoutes netkat.IngressRouteList
+	err := json.Unmarshal([]byte(IngressRouteListJson), &apiIngressRoutes)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	ingressPaths := netkat.IngressRoutesToIngressPaths(&apiIngressRoutes)
+	assert.Equal(s.T(), 2, len(ingressPaths), "Expected routes to TraefikServices to be left out")
+	assert.Equal(s.T(), "metrics-office@kubernetescrd,security-auth@kubernetescrd", ingressPaths[0].Annotations["traefik.ingress.kubernetes.io/router.middlewares"])
+	assert.Equal(s.T(), "http", ingressPaths[1].ServiceStrPort)
+
+	for _, i := range ingressPaths {
+		i.IpAddresses = lbAddress
+	}
+	components := netkat.KubernetesComponents{IngressPaths: ingressPaths}
+	for path, expected := range map[string]string{"/api/dashboards": "grafana-api", "/apis": "grafana-api", "/login": "grafana"} {
+		ingressPath, err := components.FindIngressPathForHost(&netkat.Target{Host: "grafana.foobar.com", Path: path, IpAddress: lbAddress[0]})
+		assert.Nil(s.T(), err, path)
+		assert.Equal(s.T(), expected, ingressPath.ServiceName, path)
+		assert.Equal(s.T(), netkat.IngressControllerTraefik, netkat.IngressControllerFor(ingressPath))
+	}
+}
+
+func (s *StoreSuite) TestMatchTraefikRouters() {
+	var routers []*netkat.TraefikRouter
+	err := json.Unmarshal([]byte(TraefikRoutersJson), &routers)
+	if err != nil {
+		s.T().Fatal(err)
+	}
+	for _, test := range TraefikRouterTests {
+		var names []string
+		for _, r := range netkat.MatchTraefikRouters(routers, &test.IngressPath) {
+			names = append(names, r.Name)
+		}
+		assert.Equal(s.T(), test.Expected, names, test.IngressPath.IngressName)
+	}
+	assert.Equal(s.T(), []string{"the service \"shop-web-80@kubernetes\" does not exist"}, routers[2].Errors)
+}
+
+func (s *StoreSuite) TestTraefikApiPort() {
+	helm := netkat.PodPort{Args: []string{"--entryPoints.traefik.address=:9000/tcp", "--ping=true"}}
+	assert.Equal(s.T(), int32(9000), netkat.TraefikApiPort(&helm))
+	assert.True(s.T(), netkat.TraefikPingEnabled(&helm))
+	bare := netkat.PodPort{Args: []string{"--api.insecure"}}
+	assert.Equal(s.T(), int32(8080), netkat.TraefikApiPort(&bare))
+	separate := netkat.PodPort{Args: []string{"--api.insecure", "--entrypoints.traefik.address", ":9100"}}
+	assert.Equal(s.T(), int32(9100), netkat.TraefikApiPort(&separate))
+	assert.False(s.T(), netkat.TraefikPingEnabled(&bare))
+}